@@ -3,6 +3,7 @@ package bind
 import (
 	"errors"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -13,29 +14,39 @@ import (
 
 type formBinder struct {}
 
+// DefaultMaxMultipartMemory 解析 multipart 请求时内存中最多保存的数据大小，超出部分保存到临时文件
+const DefaultMaxMultipartMemory = 32 << 20
+
+// Bind 支持 query、x-www-form-urlencoded 以及 multipart/form-data，
+// multipart 中的文件可以绑定到 *multipart.FileHeader 或者 []*multipart.FileHeader 类型的字段
 func (f *formBinder) Bind(req *http.Request, target interface{}) error {
-	err := req.ParseForm()
-	if err != nil {
+	// 已经解析过时直接返回，eg: Context 使用 Engine.MaxMultipartMemory 解析
+	err := req.ParseMultipartForm(DefaultMaxMultipartMemory)
+	if err != nil && err != http.ErrNotMultipart {
 		return err
 	}
 
-	return doBind(req.Form, reflect.ValueOf(target))
+	var files map[string][]*multipart.FileHeader
+	if req.MultipartForm != nil {
+		files = req.MultipartForm.File
+	}
+	return doBind(req.Form, files, reflect.ValueOf(target))
 }
 
-func doBind(input url.Values, target reflect.Value) error {
+func doBind(input url.Values, files map[string][]*multipart.FileHeader, target reflect.Value) error {
 	elemTyp := target.Type().Elem()
 	elemVal := target.Elem()
 	switch elemTyp.Kind() {
 	case reflect.Struct:
 		fmt.Printf("[before] name: %s\n", elemTyp.Name())
-		return bindUrlValuesToStruct(input, elemVal)
+		return bindUrlValuesToStruct(input, files, elemVal)
 	case reflect.Ptr:
 		if elemVal.IsNil() {
 			fmt.Printf("name: %s\n", elemTyp.Elem().Name())
 			newVal := reflect.New(elemTyp.Elem())
 			elemVal.Set(newVal)
 		}
-		return doBind(input, elemVal)
+		return doBind(input, files, elemVal)
 	default:
 		return ErrUnknownType
 	}
@@ -45,7 +56,12 @@ var (
 	ErrUnknownType = errors.New("unknown type")
 )
 
-func bindUrlValuesToStruct(input url.Values, targetVal reflect.Value) error {
+var (
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeaderSliceType = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
+
+func bindUrlValuesToStruct(input url.Values, files map[string][]*multipart.FileHeader, targetVal reflect.Value) error {
 	targetTyp := targetVal.Type()
 
 	// target 字段类型只能是 bool/int/float/string 即对应的 array/slice 格式
@@ -62,6 +78,19 @@ func bindUrlValuesToStruct(input url.Values, targetVal reflect.Value) error {
 		if  tag.name == ""{
 			tag.name = fieldTyp.Name
 		}
+
+		// 上传的文件
+		if fieldTyp.Type == fileHeaderType || fieldTyp.Type == fileHeaderSliceType {
+			if headers := files[tag.name]; len(headers) > 0 {
+				if fieldTyp.Type == fileHeaderType {
+					fieldVal.Set(reflect.ValueOf(headers[0]))
+				} else {
+					fieldVal.Set(reflect.ValueOf(headers))
+				}
+			}
+			continue
+		}
+
 		vals, exist := input[tag.name]
 		if !exist {
 			if tag.setDefault {
@@ -3,6 +3,7 @@ package bind
 import (
 	"github.com/smartystreets/goconvey/convey"
 	"net/url"
+	"reflect"
 	"testing"
 )
 
@@ -51,7 +52,7 @@ func Test_bindUrlValuesToStruct(t *testing.T) {
 
 		for _, testCase := range testCases {
 			var p Person
-			gotErr := bindUrlValuesToStruct(testCase.vals, &p)
+			gotErr := bindUrlValuesToStruct(testCase.vals, nil, reflect.ValueOf(&p).Elem())
 			if testCase.wantErr {
 				convey.So(gotErr, convey.ShouldNotBeNil)
 				t.Log(gotErr)
@@ -1,17 +1,33 @@
 package mini_gin
 
 import (
+	"github.com/WANGgbin/mini_gin/bind"
+	"github.com/WANGgbin/mini_gin/render"
+	"net/http"
 	"os"
 	"time"
 )
 
 type EngineOptions struct {
-	ReadTimeout       time.Duration
-	ReadHeaderTimeout time.Duration
-	WriteTimeout      time.Duration
-	IdlTimeout        time.Duration
-	Addr              string
+	ReadTimeout            time.Duration
+	ReadHeaderTimeout      time.Duration
+	WriteTimeout           time.Duration
+	IdlTimeout             time.Duration
+	Addr                   string
 	HandleMethodNotAllowed bool
+	HandleOptions          bool
+	RedirectTrailingSlash  bool
+	RedirectFixedPath      bool
+	Debug                  bool
+	ShutdownTimeout        time.Duration
+	UnixSocketMode         os.FileMode
+	GracefulRestart        bool
+	Server                 *http.Server
+	ContextWithFallback    bool
+	MaxMultipartMemory     int64
+	CookieDefaults         CookieDefaults
+	CookieKeys             [][]byte
+	SecureJSONPrefix       string
 }
 
 // EngineOption 函数选项模式的一个优势是可以解决零值的问题。
@@ -47,6 +63,96 @@ func WithHandleMethodNotAllowed() EngineOption {
 	}
 }
 
+func WithHandleOptions() EngineOption {
+	return func(ops *EngineOptions) {
+		ops.HandleOptions = true
+	}
+}
+
+func WithRedirectTrailingSlash() EngineOption {
+	return func(ops *EngineOptions) {
+		ops.RedirectTrailingSlash = true
+	}
+}
+
+func WithRedirectFixedPath() EngineOption {
+	return func(ops *EngineOptions) {
+		ops.RedirectFixedPath = true
+	}
+}
+
+func WithDebug() EngineOption {
+	return func(ops *EngineOptions) {
+		ops.Debug = true
+	}
+}
+
+// WithShutdownTimeout 优雅退出时等待进行中的请求处理完毕的最大时间，超时后强制关闭所有连接，0 表示一直等待
+func WithShutdownTimeout(timeout time.Duration) EngineOption {
+	return func(ops *EngineOptions) {
+		ops.ShutdownTimeout = timeout
+	}
+}
+
+// WithUnixSocketMode RunUnix 创建的 socket 文件的权限
+func WithUnixSocketMode(mode os.FileMode) EngineOption {
+	return func(ops *EngineOptions) {
+		ops.UnixSocketMode = mode
+	}
+}
+
+// WithGracefulRestart 开启平滑重启：收到 SIGHUP/SIGUSR2 时启动新的进程并传递监听的 socket，
+// 新进程开始提供服务后当前进程优雅退出。windows 不支持
+func WithGracefulRestart() EngineOption {
+	return func(ops *EngineOptions) {
+		ops.GracefulRestart = true
+	}
+}
+
+// WithServer 使用用户自定义的 http.Server，此时忽略 EngineOptions 中的超时设置，
+// server.Addr 为空时使用 EngineOptions.Addr，server.Handler 为空时使用 Engine
+func WithServer(server *http.Server) EngineOption {
+	return func(ops *EngineOptions) {
+		ops.Server = server
+	}
+}
+
+// WithContextFallback Context 作为 context.Context 使用时是否使用请求的 context，默认为 true
+func WithContextFallback(enable bool) EngineOption {
+	return func(ops *EngineOptions) {
+		ops.ContextWithFallback = enable
+	}
+}
+
+// WithMaxMultipartMemory 解析 multipart 请求时内存中最多保存的数据大小，超出部分保存到临时文件，默认 32MB
+func WithMaxMultipartMemory(size int64) EngineOption {
+	return func(ops *EngineOptions) {
+		ops.MaxMultipartMemory = size
+	}
+}
+
+// WithCookieDefaults 设置 cookie 的默认属性，默认 Path 为 /，SameSite 为 Lax，HttpOnly 为 true
+func WithCookieDefaults(defaults CookieDefaults) EngineOption {
+	return func(ops *EngineOptions) {
+		ops.CookieDefaults = defaults
+	}
+}
+
+// WithCookieKeys 设置签名以及加密 cookie 使用的密钥。第一个密钥用于签名以及加密，所有密钥都用于校验以及解密，
+// 轮换密钥时将新密钥放在第一个，旧密钥保留到所有旧 cookie 过期
+func WithCookieKeys(keys ...[]byte) EngineOption {
+	return func(ops *EngineOptions) {
+		ops.CookieKeys = keys
+	}
+}
+
+// WithSecureJSONPrefix 设置 Context.SecureJSON 在 json 前添加的前缀，默认为 while(1);
+func WithSecureJSONPrefix(prefix string) EngineOption {
+	return func(ops *EngineOptions) {
+		ops.SecureJSONPrefix = prefix
+	}
+}
+
 func (eo *EngineOptions) Apply(opts ...EngineOption) {
 	for _, opt := range opts {
 		opt(eo)
@@ -55,11 +161,21 @@ func (eo *EngineOptions) Apply(opts ...EngineOption) {
 
 func NewEngineOptions(opts ...EngineOption) *EngineOptions {
 	options := &EngineOptions{
-		ReadTimeout:       500 * time.Millisecond,
-		ReadHeaderTimeout: 100 * time.Millisecond,
-		WriteTimeout:      500 * time.Millisecond,
-		IdlTimeout:        5 * time.Second,
-		Addr:              getAddr(),
+		ReadTimeout:         500 * time.Millisecond,
+		ReadHeaderTimeout:   100 * time.Millisecond,
+		WriteTimeout:        500 * time.Millisecond,
+		IdlTimeout:          5 * time.Second,
+		ShutdownTimeout:     10 * time.Second,
+		UnixSocketMode:      0660,
+		ContextWithFallback: true,
+		MaxMultipartMemory:  bind.DefaultMaxMultipartMemory,
+		CookieDefaults: CookieDefaults{
+			Path:     "/",
+			SameSite: http.SameSiteLaxMode,
+			HttpOnly: true,
+		},
+		SecureJSONPrefix: render.DefaultSecureJSONPrefix,
+		Addr:             getAddr(),
 	}
 
 	options.Apply(opts...)
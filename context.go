@@ -1,34 +1,68 @@
 package mini_gin
 
 import (
+	"context"
 	"fmt"
 	"github.com/WANGgbin/mini_gin/bind"
 	"github.com/WANGgbin/mini_gin/render"
 	"github.com/WANGgbin/mini_gin/util"
+	log "github.com/sirupsen/logrus"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Context struct {
 	indexOfHandlerChain int
 	handlers            []MiddleWare
-	params              map[string]string
-
-	w   http.ResponseWriter
-	req *http.Request
-
-	status  int
-	written bool
-	e       *Engine
+	params              Params
+	// fullPath 匹配的路由，eg: /users/:id
+	fullPath string
+
+	// Writer 包装后的 http.ResponseWriter，记录响应的状态码以及 body 大小
+	Writer ResponseWriter
+	writer responseWriter
+	req    *http.Request
+
+	e *Engine
+
+	// keys 请求范围内的 key-value 存储，用于中间件向后续 handler 传递数据，eg: 认证中间件传递当前用户
+	mu   sync.RWMutex
+	keys map[string]interface{}
+
+	// queryCache 解析后的 query 参数，避免每次获取时重新解析
+	queryCache url.Values
+	// formCache 解析后的 body 中的表单参数，包括 x-www-form-urlencoded 以及 multipart/form-data
+	formCache url.Values
+
+	// copied 通过 Copy 创建的只读副本
+	copied bool
+	// released debug 模式下请求结束后设置为 true
+	released bool
 }
 
-func newContext() interface{} {
-	return &Context{}
+// Context 实现了 context.Context，可以直接传递给数据库、rpc 等客户端
+var _ context.Context = (*Context)(nil)
+
+func newContext(maxParams int) *Context {
+	ctx := &Context{
+		params: make(Params, 0, maxParams),
+	}
+	ctx.Writer = &ctx.writer
+	return ctx
 }
 
 // Next 经典的洋葱模型的实现
 func (ctx *Context) Next() {
+	ctx.checkAlive()
 	for ; ctx.indexOfHandlerChain >= 0 && ctx.indexOfHandlerChain < len(ctx.handlers); {
 		handler := ctx.handlers[ctx.indexOfHandlerChain]
 		ctx.indexOfHandlerChain++
@@ -49,10 +83,13 @@ func (ctx *Context) Abort() {
 func (ctx *Context) reset() {
 	ctx.indexOfHandlerChain = 0
 	ctx.handlers = nil
-	ctx.params = nil
+	ctx.params = ctx.params[:0]
+	ctx.fullPath = ""
 	ctx.req = nil
-	ctx.w = nil
-	ctx.written = false
+	ctx.writer.reset(nil)
+	ctx.keys = nil
+	ctx.queryCache = nil
+	ctx.formCache = nil
 }
 
 func (ctx *Context) setHandlers(handlers []MiddleWare) *Context {
@@ -65,14 +102,14 @@ func (ctx *Context) setHandlersOnRouteNotHit(status int) {
 	util.Assert(status == http.StatusMethodNotAllowed || status == http.StatusNotFound, "status should only be notFound or methodNotAllowed, but got %d", status)
 
 	if status == http.StatusMethodNotAllowed {
-		ctx.setHandlers(append(ctx.e.noMethod, methodNotAllowedHandler))
+		ctx.setHandlers(ctx.e.allNoMethod)
 	} else {
-		ctx.setHandlers(append(ctx.e.noRoute, notFoundHandler))
+		ctx.setHandlers(ctx.e.allNoRoute)
 	}
 }
 
 func (ctx *Context) setRespWriter(w http.ResponseWriter) *Context {
-	ctx.w = w
+	ctx.writer.reset(w)
 	return ctx
 }
 
@@ -90,35 +127,232 @@ func (ctx *Context) setEngine(e *Engine) *Context {
 
 // Header 获取 req 的 header
 func (ctx *Context) Header(key string) string {
+	ctx.checkAlive()
 	return ctx.req.Header.Get(key)
 }
 
 // GetRawData 获取 req.body 全部内容
 func (ctx *Context) GetRawData() ([]byte, error) {
+	ctx.checkAlive()
 	return ioutil.ReadAll(ctx.req.Body)
 }
 
 // SetHeader 设置 resp 的 header
 func (ctx *Context) SetHeader(key, value string) {
-	ctx.w.Header().Set(key, value)
+	ctx.checkWritable()
+	ctx.Writer.Header().Set(key, value)
 }
 
+// WriteHeaderAndStatus 写入响应头，只有第一次调用生效
 func (ctx *Context) WriteHeaderAndStatus(status int) {
-	if ctx.written {
-		return
-	}
-	ctx.w.WriteHeader(status)
-	ctx.written = true
-	ctx.status = status
+	ctx.checkWritable()
+	ctx.Writer.WriteHeader(status)
 }
 
 func (ctx *Context) Write(body []byte) (int, error) {
-	ctx.WriteHeaderAndStatus(http.StatusOK)
-	return ctx.w.Write(body)
+	ctx.checkWritable()
+	return ctx.Writer.Write(body)
 }
 
 func (ctx *Context) Written() bool {
-	return ctx.written
+	ctx.checkAlive()
+	return ctx.Writer.Written()
+}
+
+/*
+	USED FOR READING QUERY
+*/
+
+func (ctx *Context) initQueryCache() {
+	if ctx.queryCache == nil {
+		ctx.queryCache = ctx.req.URL.Query()
+	}
+}
+
+// Query 获取 query 参数，参数不存在时返回空字符串，eg: /users?name=tom 中 Query("name") 为 tom
+func (ctx *Context) Query(key string) string {
+	value, _ := ctx.GetQuery(key)
+	return value
+}
+
+// DefaultQuery 同 Query，参数不存在时返回 defaultValue
+func (ctx *Context) DefaultQuery(key, defaultValue string) string {
+	if value, ok := ctx.GetQuery(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// GetQuery 获取 query 参数，并返回参数是否存在，参数存在多个值时返回第一个
+func (ctx *Context) GetQuery(key string) (string, bool) {
+	if values, ok := ctx.GetQueryArray(key); ok {
+		return values[0], true
+	}
+	return "", false
+}
+
+// QueryArray 获取 query 参数的所有值，eg: /users?id=1&id=2 中 QueryArray("id") 为 [1 2]
+func (ctx *Context) QueryArray(key string) []string {
+	values, _ := ctx.GetQueryArray(key)
+	return values
+}
+
+// GetQueryArray 同 QueryArray，并返回参数是否存在
+func (ctx *Context) GetQueryArray(key string) ([]string, bool) {
+	ctx.checkAlive()
+	ctx.initQueryCache()
+	values, ok := ctx.queryCache[key]
+	return values, ok && len(values) > 0
+}
+
+// QueryMap 获取 map 形式的 query 参数，eg: /users?filter[name]=tom&filter[age]=10 中 QueryMap("filter") 为 {name: tom, age: 10}
+func (ctx *Context) QueryMap(key string) map[string]string {
+	dict, _ := ctx.GetQueryMap(key)
+	return dict
+}
+
+// GetQueryMap 同 QueryMap，并返回参数是否存在
+func (ctx *Context) GetQueryMap(key string) (map[string]string, bool) {
+	ctx.checkAlive()
+	ctx.initQueryCache()
+	return getMapFromValues(ctx.queryCache, key)
+}
+
+// getMapFromValues 获取 values 中所有 key[subKey] 形式的参数
+func getMapFromValues(values url.Values, key string) (map[string]string, bool) {
+	dict := make(map[string]string)
+	exists := false
+	for k, v := range values {
+		if i := strings.IndexByte(k, '['); i >= 1 && k[:i] == key {
+			if j := strings.IndexByte(k[i+1:], ']'); j >= 1 && i+j+2 == len(k) {
+				exists = true
+				dict[k[i+1:i+1+j]] = v[0]
+			}
+		}
+	}
+	return dict, exists
+}
+
+/*
+	USED FOR READING FORM
+*/
+
+// parseMultipartForm 解析 body 中的表单，multipart 请求内存中最多保存 Engine.MaxMultipartMemory 大小的数据，超出部分保存到临时文件
+func (ctx *Context) parseMultipartForm() error {
+	if err := ctx.req.ParseMultipartForm(ctx.e.MaxMultipartMemory); err != nil && err != http.ErrNotMultipart {
+		return err
+	}
+	return nil
+}
+
+func (ctx *Context) initFormCache() {
+	if ctx.formCache == nil {
+		if err := ctx.parseMultipartForm(); err != nil {
+			log.Errorf("parse multipart form error: %v", err)
+		}
+		ctx.formCache = ctx.req.PostForm
+		if ctx.formCache == nil {
+			ctx.formCache = make(url.Values)
+		}
+	}
+}
+
+// PostForm 获取 body 中的表单参数，参数不存在时返回空字符串
+func (ctx *Context) PostForm(key string) string {
+	value, _ := ctx.GetPostForm(key)
+	return value
+}
+
+// DefaultPostForm 同 PostForm，参数不存在时返回 defaultValue
+func (ctx *Context) DefaultPostForm(key, defaultValue string) string {
+	if value, ok := ctx.GetPostForm(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// GetPostForm 获取 body 中的表单参数，并返回参数是否存在，参数存在多个值时返回第一个
+func (ctx *Context) GetPostForm(key string) (string, bool) {
+	if values, ok := ctx.GetPostFormArray(key); ok {
+		return values[0], true
+	}
+	return "", false
+}
+
+// PostFormArray 获取 body 中的表单参数的所有值
+func (ctx *Context) PostFormArray(key string) []string {
+	values, _ := ctx.GetPostFormArray(key)
+	return values
+}
+
+// GetPostFormArray 同 PostFormArray，并返回参数是否存在
+func (ctx *Context) GetPostFormArray(key string) ([]string, bool) {
+	ctx.checkAlive()
+	ctx.initFormCache()
+	values, ok := ctx.formCache[key]
+	return values, ok && len(values) > 0
+}
+
+// PostFormMap 获取 body 中 map 形式的表单参数，参考 QueryMap
+func (ctx *Context) PostFormMap(key string) map[string]string {
+	dict, _ := ctx.GetPostFormMap(key)
+	return dict
+}
+
+// GetPostFormMap 同 PostFormMap，并返回参数是否存在
+func (ctx *Context) GetPostFormMap(key string) (map[string]string, bool) {
+	ctx.checkAlive()
+	ctx.initFormCache()
+	return getMapFromValues(ctx.formCache, key)
+}
+
+// FormFile 获取上传的文件，存在多个同名文件时返回第一个
+func (ctx *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	if headers := form.File[name]; len(headers) > 0 {
+		return headers[0], nil
+	}
+	return nil, http.ErrMissingFile
+}
+
+// MultipartForm 获取解析后的 multipart 表单，包括所有的参数以及上传的文件
+func (ctx *Context) MultipartForm() (*multipart.Form, error) {
+	ctx.checkAlive()
+	if err := ctx.req.ParseMultipartForm(ctx.e.MaxMultipartMemory); err != nil {
+		return nil, err
+	}
+	return ctx.req.MultipartForm, nil
+}
+
+// MultipartReader 以流的方式逐个读取 multipart 请求的 part，不会缓存到内存或者临时文件，适用于上传大文件。
+// 使用 MultipartReader 后不能再调用 PostForm、FormFile 等需要解析整个表单的方法，反之亦然
+func (ctx *Context) MultipartReader() (*multipart.Reader, error) {
+	ctx.checkAlive()
+	return ctx.req.MultipartReader()
+}
+
+// SaveUploadedFile 将上传的文件保存到 dst，dst 所在的目录不存在时自动创建
+func (ctx *Context) SaveUploadedFile(file *multipart.FileHeader, dst string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, src)
+	return err
 }
 
 /*
@@ -129,11 +363,16 @@ func (ctx *Context) BindJSON(target interface{}) error {
 	return ctx.bind(target, bind.JSON)
 }
 
+// BindFORM 绑定 query 以及 body 中的表单参数，支持 multipart/form-data 以及上传的文件
 func (ctx *Context) BindFORM(target interface{}) error {
+	if err := ctx.parseMultipartForm(); err != nil {
+		return err
+	}
 	return ctx.bind(target, bind.FORM)
 }
 
 func (ctx *Context) bind(target interface{}, binder bind.Binder) error {
+	ctx.checkAlive()
 	util.Assert(reflect.TypeOf(target).Kind() == reflect.Ptr, "target must be a pointer")
 
 	return binder.Bind(ctx.req, target)
@@ -144,35 +383,299 @@ func (ctx *Context) bind(target interface{}, binder bind.Binder) error {
 */
 
 func (ctx *Context) JSON(status int, result interface{}) error {
-	return ctx.render(status, result, render.JSON)
+	return ctx.Render(status, render.Marshal(render.JSON, result))
 }
 
-func (ctx *Context) render(status int, result interface{}, render render.Render) error {
-	ctx.SetHeader("content-type", render.ContentType())
-	ctx.WriteHeaderAndStatus(status)
-	resultByte, err := render.Render(result)
-	if err != nil {
-		return err
+// IndentedJSON 格式化后的 json，便于阅读，但是会增大响应的大小
+func (ctx *Context) IndentedJSON(status int, result interface{}) error {
+	return ctx.Render(status, render.Marshal(render.IndentedJSON, result))
+}
+
+// PureJSON 不转义 <、>、& 等 html 字符的 json
+func (ctx *Context) PureJSON(status int, result interface{}) error {
+	return ctx.Render(status, render.Marshal(render.PureJSON, result))
+}
+
+// AsciiJSON 将非 ascii 字符转义为 \uXXXX 的 json
+func (ctx *Context) AsciiJSON(status int, result interface{}) error {
+	return ctx.Render(status, render.Marshal(render.AsciiJSON, result))
+}
+
+// JSONP query 中存在 callback 参数时返回 callback(json);，否则同 JSON
+func (ctx *Context) JSONP(status int, result interface{}) error {
+	callback := ctx.Query("callback")
+	if callback == "" {
+		return ctx.JSON(status, result)
 	}
+	return ctx.Render(status, render.Marshal(render.JSONP(callback), result))
+}
 
-	n, err := ctx.Write(resultByte)
-	if err != nil {
-		return err
+// SecureJSON 在 json 前添加 Engine.SecureJSONPrefix，防止 json 劫持
+func (ctx *Context) SecureJSON(status int, result interface{}) error {
+	return ctx.Render(status, render.Marshal(render.SecureJSON(ctx.e.SecureJSONPrefix), result))
+}
+
+func (ctx *Context) XML(status int, result interface{}) error {
+	return ctx.Render(status, render.Marshal(render.XML, result))
+}
+
+func (ctx *Context) YAML(status int, result interface{}) error {
+	return ctx.Render(status, render.Marshal(render.YAML, result))
+}
+
+// String 返回纯文本，format 以及 values 同 fmt.Sprintf
+func (ctx *Context) String(status int, format string, values ...interface{}) error {
+	if len(values) > 0 {
+		format = fmt.Sprintf(format, values...)
 	}
+	return ctx.Render(status, render.Marshal(render.String, format))
+}
+
+// Data 直接返回 data，响应的 content-type 为 contentType
+func (ctx *Context) Data(status int, contentType string, data []byte) error {
+	return ctx.Render(status, render.Marshal(render.Data(contentType), data))
+}
 
-	if n != len(resultByte) {
-		return fmt.Errorf("write less")
+// HTML 使用 Engine.LoadHTMLGlob 等加载的模板中名为 name 的模板渲染 data
+func (ctx *Context) HTML(status int, name string, data interface{}) error {
+	util.Assert(ctx.e.htmlRender != nil, "html templates should be loaded by Engine.LoadHTMLGlob, LoadHTMLFiles, LoadHTMLFS or SetHTMLTemplate before rendering html")
+	return ctx.Render(status, ctx.e.htmlRender.Instance(name, data))
+}
+
+// Render 使用 r 渲染响应，状态码在 r 写入第一个字节时才写入，
+// 所以 r 在此之前返回错误时，响应为 500 且不包含 r 设置的 content-type
+func (ctx *Context) Render(status int, r render.Render) error {
+	ctx.checkWritable()
+	r.WriteContentType(ctx.Writer)
+	if err := r.Render(&renderWriter{ResponseWriter: ctx.Writer, status: status}); err != nil {
+		if !ctx.Writer.Written() {
+			ctx.Writer.Header().Del("Content-Type")
+			ctx.Writer.WriteHeader(http.StatusInternalServerError)
+		}
+		return err
 	}
 
+	// 响应体为空
+	ctx.Writer.WriteHeader(status)
 	return nil
 }
 
 // Param 获取路由的动态参数
+// 对于 catch-all 参数，值为通配符所在位置之后的剩余路径，eg: /static/*filepath 匹配 /static/css/a.css 时，filepath 为 css/a.css
 func (ctx *Context) Param(key string) string {
-	return ctx.params[key]
+	ctx.checkAlive()
+	return ctx.params.ByName(key)
 }
 
-func (ctx *Context) setParams(params map[string]string) *Context {
-	ctx.params = params
-	return ctx
+// FullPath 获取匹配的路由，eg: /users/:id，未匹配任何路由时为空
+func (ctx *Context) FullPath() string {
+	ctx.checkAlive()
+	return ctx.fullPath
+}
+
+// Copy 返回当前 Context 的只读副本，包括请求、路由参数、通过 Set 设置的 key-value 以及匹配的路由。
+// Context 在请求结束后会被复用，所以在 handler 启动的 goroutine 中需要使用副本，通过副本写响应会 panic，副本的 Writer 为 nil
+func (ctx *Context) Copy() *Context {
+	ctx.checkAlive()
+	cp := &Context{
+		indexOfHandlerChain: abortIndex,
+		req:                 ctx.req,
+		e:                   ctx.e,
+		fullPath:            ctx.fullPath,
+		copied:              true,
+	}
+	cp.params = make(Params, len(ctx.params))
+	copy(cp.params, ctx.params)
+
+	ctx.mu.RLock()
+	defer ctx.mu.RUnlock()
+	if ctx.keys != nil {
+		cp.keys = make(map[string]interface{}, len(ctx.keys))
+		for key, value := range ctx.keys {
+			cp.keys[key] = value
+		}
+	}
+	return cp
+}
+
+func (ctx *Context) checkAlive() {
+	util.Assert(!ctx.released, "context is used after the request finished, use Context.Copy() in goroutines")
+}
+
+func (ctx *Context) checkWritable() {
+	ctx.checkAlive()
+	util.Assert(!ctx.copied, "can not write response through a copied context")
+}
+
+// Request 获取原始的 http 请求
+func (ctx *Context) Request() *http.Request {
+	ctx.checkAlive()
+	return ctx.req
+}
+
+/*
+	IMPLEMENT context.Context
+*/
+
+// requestContext 开启 ContextWithFallback 时返回请求的 context，否则返回 nil
+func (ctx *Context) requestContext() context.Context {
+	ctx.checkAlive()
+	if ctx.req == nil || !ctx.e.ContextWithFallback {
+		return nil
+	}
+	return ctx.req.Context()
+}
+
+// Deadline 同 req.Context().Deadline()，请求的 context 在客户端断开连接或者服务关闭时取消
+func (ctx *Context) Deadline() (deadline time.Time, ok bool) {
+	if reqCtx := ctx.requestContext(); reqCtx != nil {
+		return reqCtx.Deadline()
+	}
+	return
+}
+
+// Done 同 req.Context().Done()
+func (ctx *Context) Done() <-chan struct{} {
+	if reqCtx := ctx.requestContext(); reqCtx != nil {
+		return reqCtx.Done()
+	}
+	return nil
+}
+
+// Err 同 req.Context().Err()
+func (ctx *Context) Err() error {
+	if reqCtx := ctx.requestContext(); reqCtx != nil {
+		return reqCtx.Err()
+	}
+	return nil
+}
+
+// Value 优先返回通过 Set 设置的值，不存在时返回 req.Context().Value(key)
+func (ctx *Context) Value(key interface{}) interface{} {
+	if keyAsString, ok := key.(string); ok {
+		if value, exists := ctx.Get(keyAsString); exists {
+			return value
+		}
+	}
+	if reqCtx := ctx.requestContext(); reqCtx != nil {
+		return reqCtx.Value(key)
+	}
+	return nil
+}
+
+/*
+	KEY-VALUE STORAGE
+*/
+
+// Set 存储请求范围内的 key-value，可以在多个 goroutine 中并发使用
+func (ctx *Context) Set(key string, value interface{}) {
+	ctx.checkAlive()
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if ctx.keys == nil {
+		ctx.keys = make(map[string]interface{})
+	}
+	ctx.keys[key] = value
+}
+
+// Get 获取通过 Set 设置的值
+func (ctx *Context) Get(key string) (value interface{}, exists bool) {
+	ctx.checkAlive()
+	ctx.mu.RLock()
+	defer ctx.mu.RUnlock()
+	value, exists = ctx.keys[key]
+	return
+}
+
+// MustGet 同 Get，key 不存在时 panic
+func (ctx *Context) MustGet(key string) interface{} {
+	value, exists := ctx.Get(key)
+	util.Assert(exists, "key %s does not exist", key)
+	return value
+}
+
+// 以下方法获取指定类型的值，key 不存在或者类型不匹配时返回零值
+
+func (ctx *Context) GetString(key string) (s string) {
+	if value, ok := ctx.Get(key); ok {
+		s, _ = value.(string)
+	}
+	return
+}
+
+func (ctx *Context) GetBool(key string) (b bool) {
+	if value, ok := ctx.Get(key); ok {
+		b, _ = value.(bool)
+	}
+	return
+}
+
+func (ctx *Context) GetInt(key string) (i int) {
+	if value, ok := ctx.Get(key); ok {
+		i, _ = value.(int)
+	}
+	return
+}
+
+func (ctx *Context) GetInt64(key string) (i int64) {
+	if value, ok := ctx.Get(key); ok {
+		i, _ = value.(int64)
+	}
+	return
+}
+
+func (ctx *Context) GetUint(key string) (u uint) {
+	if value, ok := ctx.Get(key); ok {
+		u, _ = value.(uint)
+	}
+	return
+}
+
+func (ctx *Context) GetUint64(key string) (u uint64) {
+	if value, ok := ctx.Get(key); ok {
+		u, _ = value.(uint64)
+	}
+	return
+}
+
+func (ctx *Context) GetFloat64(key string) (f float64) {
+	if value, ok := ctx.Get(key); ok {
+		f, _ = value.(float64)
+	}
+	return
+}
+
+func (ctx *Context) GetTime(key string) (t time.Time) {
+	if value, ok := ctx.Get(key); ok {
+		t, _ = value.(time.Time)
+	}
+	return
+}
+
+func (ctx *Context) GetDuration(key string) (d time.Duration) {
+	if value, ok := ctx.Get(key); ok {
+		d, _ = value.(time.Duration)
+	}
+	return
+}
+
+func (ctx *Context) GetStringSlice(key string) (ss []string) {
+	if value, ok := ctx.Get(key); ok {
+		ss, _ = value.([]string)
+	}
+	return
+}
+
+func (ctx *Context) GetStringMap(key string) (sm map[string]interface{}) {
+	if value, ok := ctx.Get(key); ok {
+		sm, _ = value.(map[string]interface{})
+	}
+	return
+}
+
+func (ctx *Context) GetStringMapString(key string) (sms map[string]string) {
+	if value, ok := ctx.Get(key); ok {
+		sms, _ = value.(map[string]string)
+	}
+	return
 }
@@ -1,9 +1,22 @@
 package mini_gin
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"github.com/WANGgbin/mini_gin/render"
+	"github.com/smartystreets/goconvey/convey"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestBindFORM(t *testing.T) {
@@ -49,4 +62,427 @@ func TestJSON(t *testing.T) {
 		}
 	})
 	app.Run()
-}
\ No newline at end of file
+}
+
+func TestContext_Keys(t *testing.T) {
+	convey.Convey("", t, func() {
+		app := New()
+		authMW := func(ctx *Context) {
+			ctx.Set("user", "tom")
+			ctx.Set("uid", 42)
+		}
+		var user, missing string
+		var uid int
+		app.Use(authMW)
+		app.GET("/me", func(ctx *Context) {
+			user = ctx.GetString("user")
+			uid = ctx.GetInt("uid")
+			missing = ctx.GetString("uid")
+			convey.So(ctx.MustGet("user"), convey.ShouldEqual, "tom")
+			convey.So(func() { ctx.MustGet("not exist") }, convey.ShouldPanic)
+		})
+
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/me", nil))
+		convey.So(user, convey.ShouldEqual, "tom")
+		convey.So(uid, convey.ShouldEqual, 42)
+		convey.So(missing, convey.ShouldEqual, "")
+	})
+}
+
+type ctxKey struct{}
+
+func TestContext_Context(t *testing.T) {
+	convey.Convey("", t, func() {
+		testCases := []struct {
+			name         string
+			fallback     bool
+			wantDeadline bool
+			wantErr      error
+			wantValue    interface{}
+		}{
+			{name: "fallback", fallback: true, wantDeadline: true, wantErr: context.Canceled, wantValue: "request"},
+			{name: "no fallback", fallback: false, wantDeadline: false, wantErr: nil, wantValue: nil},
+		}
+
+		for _, testCase := range testCases {
+			convey.Convey(testCase.name, func() {
+				app := NewWithCfg(WithContextFallback(testCase.fallback))
+				var (
+					hasDeadline bool
+					err         error
+					value       interface{}
+					user        interface{}
+				)
+				app.GET("/", func(ctx *Context) {
+					ctx.Set("user", "tom")
+					// 作为 context.Context 传递
+					var c context.Context = ctx
+					_, hasDeadline = c.Deadline()
+					err = c.Err()
+					value = c.Value(ctxKey{})
+					user = c.Value("user")
+				})
+
+				reqCtx, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "request"), time.Minute)
+				cancel()
+				req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(reqCtx)
+				app.ServeHTTP(httptest.NewRecorder(), req)
+				convey.So(hasDeadline, convey.ShouldEqual, testCase.wantDeadline)
+				convey.So(err, convey.ShouldEqual, testCase.wantErr)
+				convey.So(value, convey.ShouldEqual, testCase.wantValue)
+				convey.So(user, convey.ShouldEqual, "tom")
+			})
+		}
+	})
+}
+
+func TestContext_Copy(t *testing.T) {
+	convey.Convey("", t, func() {
+		convey.Convey("copy", func() {
+			app := New()
+			copied := make(chan *Context, 1)
+			app.GET("/users/:id", func(ctx *Context) {
+				ctx.Set("user", "tom")
+				copied <- ctx.Copy()
+			})
+			app.GET("/orders/:id", func(ctx *Context) {
+				ctx.Set("user", "jerry")
+			})
+
+			app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+			// 复用的 Context 处理其他请求不影响副本
+			app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders/2", nil))
+			cp := <-copied
+			convey.So(cp.Param("id"), convey.ShouldEqual, "1")
+			convey.So(cp.GetString("user"), convey.ShouldEqual, "tom")
+			convey.So(cp.FullPath(), convey.ShouldEqual, "/users/:id")
+			convey.So(cp.Request().URL.Path, convey.ShouldEqual, "/users/1")
+			convey.So(func() { _, _ = cp.Write([]byte("ok")) }, convey.ShouldPanic)
+		})
+
+		convey.Convey("full path of split node", func() {
+			testCases := []struct {
+				routes []string
+				target string
+				want   string
+			}{
+				{routes: []string{"/users/:id/profile", "/users/:id"}, target: "/users/1", want: "/users/:id"},
+				{routes: []string{"/abc", "/ab"}, target: "/ab", want: "/ab"},
+				{routes: []string{"/ab", "/abc"}, target: "/abc", want: "/abc"},
+			}
+
+			for _, testCase := range testCases {
+				app := New()
+				var fullPath, copiedFullPath string
+				for _, route := range testCase.routes {
+					app.GET(route, func(ctx *Context) {
+						fullPath = ctx.FullPath()
+						copiedFullPath = ctx.Copy().FullPath()
+					})
+				}
+
+				app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, testCase.target, nil))
+				convey.So(fullPath, convey.ShouldEqual, testCase.want)
+				convey.So(copiedFullPath, convey.ShouldEqual, testCase.want)
+			}
+		})
+
+		convey.Convey("use after release in debug mode", func() {
+			app := NewWithCfg(WithDebug())
+			var leaked *Context
+			app.GET("/users/:id", func(ctx *Context) {
+				leaked = ctx
+			})
+
+			app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+			convey.So(func() { leaked.Param("id") }, convey.ShouldPanic)
+			convey.So(func() { leaked.Copy() }, convey.ShouldPanic)
+		})
+	})
+}
+
+func TestContext_Query(t *testing.T) {
+	convey.Convey("", t, func() {
+		app := New()
+		ctxCh := make(chan func(ctx *Context), 1)
+		app.GET("/users", func(ctx *Context) {
+			(<-ctxCh)(ctx)
+		})
+		serve := func(route string, fn func(ctx *Context)) {
+			ctxCh <- fn
+			app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, route, nil))
+		}
+
+		serve("/users?name=tom&id=1&id=2&empty=&filter[name]=tom&filter[age]=10&filter=x&filter[]=y", func(ctx *Context) {
+			convey.So(ctx.Query("name"), convey.ShouldEqual, "tom")
+			convey.So(ctx.Query("id"), convey.ShouldEqual, "1")
+			convey.So(ctx.QueryArray("id"), convey.ShouldResemble, []string{"1", "2"})
+			convey.So(ctx.DefaultQuery("page", "1"), convey.ShouldEqual, "1")
+			convey.So(ctx.DefaultQuery("empty", "1"), convey.ShouldEqual, "")
+			value, ok := ctx.GetQuery("empty")
+			convey.So(value, convey.ShouldEqual, "")
+			convey.So(ok, convey.ShouldBeTrue)
+			_, ok = ctx.GetQuery("page")
+			convey.So(ok, convey.ShouldBeFalse)
+			convey.So(ctx.QueryMap("filter"), convey.ShouldResemble, map[string]string{"name": "tom", "age": "10"})
+			_, ok = ctx.GetQueryMap("name")
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+		// 复用的 Context 不会使用上一个请求的 query
+		serve("/users?name=jerry", func(ctx *Context) {
+			convey.So(ctx.Query("name"), convey.ShouldEqual, "jerry")
+			convey.So(ctx.QueryArray("id"), convey.ShouldBeNil)
+		})
+	})
+}
+
+func TestContext_MultipartForm(t *testing.T) {
+	convey.Convey("", t, func() {
+		newRequest := func() *http.Request {
+			body := new(bytes.Buffer)
+			mw := multipart.NewWriter(body)
+			_ = mw.WriteField("name", "tom")
+			_ = mw.WriteField("tags[color]", "red")
+			fw, _ := mw.CreateFormFile("file", "a.txt")
+			_, _ = fw.Write([]byte("hello"))
+			_ = mw.Close()
+			req := httptest.NewRequest(http.MethodPost, "/upload?page=1", body)
+			req.Header.Set("Content-Type", mw.FormDataContentType())
+			return req
+		}
+
+		convey.Convey("form and file", func() {
+			dir, _ := ioutil.TempDir("", "mini_gin")
+			defer os.RemoveAll(dir)
+
+			app := NewWithCfg(WithMaxMultipartMemory(1 << 10))
+			app.POST("/upload", func(ctx *Context) {
+				convey.So(ctx.PostForm("name"), convey.ShouldEqual, "tom")
+				convey.So(ctx.PostForm("page"), convey.ShouldEqual, "")
+				convey.So(ctx.DefaultPostForm("age", "10"), convey.ShouldEqual, "10")
+				convey.So(ctx.PostFormMap("tags"), convey.ShouldResemble, map[string]string{"color": "red"})
+
+				file, err := ctx.FormFile("file")
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(file.Filename, convey.ShouldEqual, "a.txt")
+				convey.So(ctx.SaveUploadedFile(file, filepath.Join(dir, "sub", file.Filename)), convey.ShouldBeNil)
+				_, err = ctx.FormFile("not exist")
+				convey.So(err, convey.ShouldEqual, http.ErrMissingFile)
+
+				var form struct {
+					Name string                `form:"name"`
+					Page int                   `form:"page"`
+					File *multipart.FileHeader `form:"file"`
+				}
+				convey.So(ctx.BindFORM(&form), convey.ShouldBeNil)
+				convey.So(form.Name, convey.ShouldEqual, "tom")
+				convey.So(form.Page, convey.ShouldEqual, 1)
+				convey.So(form.File.Filename, convey.ShouldEqual, "a.txt")
+			})
+
+			app.ServeHTTP(httptest.NewRecorder(), newRequest())
+			content, err := ioutil.ReadFile(filepath.Join(dir, "sub", "a.txt"))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(string(content), convey.ShouldEqual, "hello")
+		})
+
+		convey.Convey("stream", func() {
+			app := New()
+			var parts []string
+			app.POST("/upload", func(ctx *Context) {
+				reader, err := ctx.MultipartReader()
+				convey.So(err, convey.ShouldBeNil)
+				for {
+					part, err := reader.NextPart()
+					if err != nil {
+						break
+					}
+					content, _ := ioutil.ReadAll(part)
+					parts = append(parts, part.FormName()+"="+string(content))
+				}
+			})
+
+			app.ServeHTTP(httptest.NewRecorder(), newRequest())
+			convey.So(parts, convey.ShouldResemble, []string{"name=tom", "tags[color]=red", "file=hello"})
+		})
+	})
+}
+
+func TestContext_Writer(t *testing.T) {
+	convey.Convey("", t, func() {
+		convey.Convey("logger", func() {
+			dest := new(bytes.Buffer)
+			defer func(cfg LoggerCfg) { *loggerCfg = cfg }(*loggerCfg)
+			app := New()
+			app.Use(LoggerMWWithCfg(LoggerWithDest(dest), LoggerWithPattern(func(param *LoggerParam) string {
+				return fmt.Sprintf("%s %s %d %d\n", param.Method, param.Route, param.StatusCode, param.BodySize)
+			})))
+			app.GET("/created", func(ctx *Context) {
+				ctx.Writer.WriteHeader(http.StatusCreated)
+				_, _ = ctx.Writer.WriteString("created")
+			})
+			app.GET("/wrap", WrapF(func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				_, _ = w.Write([]byte("ok"))
+			}))
+
+			for _, route := range []string{"/created", "/wrap", "/not/exist"} {
+				app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, route, nil))
+			}
+			convey.So(dest.String(), convey.ShouldEqual, "GET /created 201 7\nGET /wrap 202 2\nGET /not/exist 404 9\n")
+		})
+
+		convey.Convey("flush, push and hijack", func() {
+			app := New()
+			var status int
+			var pushErr, hijackErr error
+			app.GET("/", func(ctx *Context) {
+				ctx.Writer.Flush()
+				status = ctx.Writer.Status()
+				pushErr = ctx.Writer.Push("/a.css", nil)
+				_, _, hijackErr = ctx.Writer.Hijack()
+			})
+
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			convey.So(w.Flushed, convey.ShouldBeTrue)
+			convey.So(status, convey.ShouldEqual, http.StatusOK)
+			convey.So(pushErr, convey.ShouldEqual, http.ErrNotSupported)
+			convey.So(hijackErr, convey.ShouldNotBeNil)
+		})
+	})
+}
+
+func TestContext_Render(t *testing.T) {
+	convey.Convey("", t, func() {
+		type user struct {
+			XMLName struct{} `json:"-" xml:"user" yaml:"-"`
+			Name    string   `json:"name" xml:"name" yaml:"name"`
+		}
+		tom := user{Name: "<tom>"}
+		tmpl := template.Must(template.New("hello").Parse(`<p>hello {{.Name}}</p>`))
+
+		testCases := []struct {
+			name            string
+			route           string
+			render          func(ctx *Context) error
+			wantContentType string
+			wantBody        string
+			wantErr         bool
+		}{
+			{name: "string", route: "/", render: func(ctx *Context) error { return ctx.String(http.StatusOK, "hello %s", "tom") }, wantContentType: "text/plain; charset=utf-8", wantBody: "hello tom"},
+			{name: "data", route: "/", render: func(ctx *Context) error { return ctx.Data(http.StatusOK, "image/png", []byte{1, 2}) }, wantContentType: "image/png", wantBody: "\x01\x02"},
+			{name: "xml", route: "/", render: func(ctx *Context) error { return ctx.XML(http.StatusOK, tom) }, wantContentType: "application/xml; charset=utf-8", wantBody: "<user><name>&lt;tom&gt;</name></user>"},
+			{name: "yaml", route: "/", render: func(ctx *Context) error { return ctx.YAML(http.StatusOK, tom) }, wantContentType: "application/x-yaml; charset=utf-8", wantBody: "name: <tom>\n"},
+			{name: "indented json", route: "/", render: func(ctx *Context) error { return ctx.IndentedJSON(http.StatusOK, tom) }, wantContentType: "application/json; charset=utf-8", wantBody: "{\n    \"name\": \"\\u003ctom\\u003e\"\n}"},
+			{name: "pure json", route: "/", render: func(ctx *Context) error { return ctx.PureJSON(http.StatusOK, tom) }, wantContentType: "application/json; charset=utf-8", wantBody: `{"name":"<tom>"}`},
+			{name: "ascii json", route: "/", render: func(ctx *Context) error { return ctx.AsciiJSON(http.StatusOK, []string{"中", "😀"}) }, wantContentType: "application/json; charset=utf-8", wantBody: `["\u4e2d","\ud83d\ude00"]`},
+			{name: "jsonp", route: "/?callback=app.cb", render: func(ctx *Context) error { return ctx.JSONP(http.StatusOK, tom) }, wantContentType: "application/javascript; charset=utf-8", wantBody: `app.cb({"name":"\u003ctom\u003e"});`},
+			{name: "jsonp without callback", route: "/", render: func(ctx *Context) error { return ctx.JSONP(http.StatusOK, tom) }, wantContentType: "application/json", wantBody: `{"name":"\u003ctom\u003e"}`},
+			{name: "jsonp invalid callback", route: "/?callback=alert(1)", render: func(ctx *Context) error { return ctx.JSONP(http.StatusOK, tom) }, wantErr: true},
+			{name: "secure json", route: "/", render: func(ctx *Context) error { return ctx.SecureJSON(http.StatusOK, []int{1, 2}) }, wantContentType: "application/json; charset=utf-8", wantBody: "while(1);[1,2]"},
+			{name: "html", route: "/", render: func(ctx *Context) error { return ctx.HTML(http.StatusOK, "hello", tom) }, wantContentType: "text/html; charset=utf-8", wantBody: "<p>hello &lt;tom&gt;</p>"},
+		}
+
+		for _, testCase := range testCases {
+			convey.Convey(testCase.name, func() {
+				app := New()
+				app.SetHTMLTemplate(tmpl)
+				var err error
+				app.GET("/", func(ctx *Context) {
+					err = testCase.render(ctx)
+				})
+
+				w := httptest.NewRecorder()
+				app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, testCase.route, nil))
+				convey.So(err != nil, convey.ShouldEqual, testCase.wantErr)
+				convey.So(w.Header().Get("Content-Type"), convey.ShouldEqual, testCase.wantContentType)
+				convey.So(w.Body.String(), convey.ShouldEqual, testCase.wantBody)
+			})
+		}
+	})
+}
+
+// chunkRender 逐个写入 chunks，写入 failAt 个 chunk 后返回错误
+type chunkRender struct {
+	chunks []string
+	failAt int
+}
+
+func (r *chunkRender) Render(w http.ResponseWriter) error {
+	for idx, chunk := range r.chunks {
+		if idx == r.failAt {
+			return errors.New("render failed")
+		}
+		if _, err := io.WriteString(w, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *chunkRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/csv")
+}
+
+// jsonItems 依次返回 values 中的元素，返回 failAt 个元素后返回错误
+func jsonItems(failAt int, values ...interface{}) func() (interface{}, error) {
+	idx := 0
+	return func() (interface{}, error) {
+		if idx == failAt {
+			return nil, errors.New("query failed")
+		}
+		if idx == len(values) {
+			return nil, io.EOF
+		}
+		idx++
+		return values[idx-1], nil
+	}
+}
+
+func TestContext_StreamRender(t *testing.T) {
+	convey.Convey("", t, func() {
+		// 模板执行到 fail 时已经写入了 <p>ok</p>
+		tmpl := template.Must(template.New("page").Funcs(template.FuncMap{
+			"fail": func() (string, error) { return "", errors.New("template failed") },
+		}).Parse(`<p>ok</p>{{fail}}`))
+
+		testCases := []struct {
+			name            string
+			render          render.Render
+			wantStatus      int
+			wantContentType string
+			wantBody        string
+			wantErr         bool
+		}{
+			{name: "stream", render: &chunkRender{chunks: []string{"a,b\n", "1,2\n"}, failAt: -1}, wantStatus: http.StatusCreated, wantContentType: "text/csv", wantBody: "a,b\n1,2\n"},
+			{name: "empty body", render: &chunkRender{failAt: -1}, wantStatus: http.StatusCreated, wantContentType: "text/csv"},
+			{name: "fail before first byte", render: &chunkRender{chunks: []string{"a,b\n"}, failAt: 0}, wantStatus: http.StatusInternalServerError, wantErr: true},
+			{name: "fail after first byte", render: &chunkRender{chunks: []string{"a,b\n", "1,2\n"}, failAt: 1}, wantStatus: http.StatusCreated, wantContentType: "text/csv", wantBody: "a,b\n", wantErr: true},
+			{name: "marshaler", render: render.Marshal(render.JSON, map[string]int{"a": 1}), wantStatus: http.StatusCreated, wantContentType: "application/json", wantBody: `{"a":1}`},
+			{name: "html partial write", render: render.HTMLTemplate(tmpl).Instance("page", nil), wantStatus: http.StatusCreated, wantContentType: "text/html; charset=utf-8", wantBody: "<p>ok</p>", wantErr: true},
+			{name: "json stream", render: render.JSONStream(jsonItems(-1, 1, "<a>", map[string]bool{"b": true})), wantStatus: http.StatusCreated, wantContentType: "application/json; charset=utf-8", wantBody: `[1,"\u003ca\u003e",{"b":true}]`},
+			{name: "empty json stream", render: render.JSONStream(jsonItems(-1)), wantStatus: http.StatusCreated, wantContentType: "application/json; charset=utf-8", wantBody: "[]"},
+			{name: "json stream fail before first item", render: render.JSONStream(jsonItems(0, 1, 2)), wantStatus: http.StatusInternalServerError, wantErr: true},
+			{name: "json stream fail after first item", render: render.JSONStream(jsonItems(1, 1, 2)), wantStatus: http.StatusCreated, wantContentType: "application/json; charset=utf-8", wantBody: "[1", wantErr: true},
+			{name: "marshal failed", render: render.Marshal(render.JSON, func() {}), wantStatus: http.StatusInternalServerError, wantErr: true},
+		}
+
+		for _, testCase := range testCases {
+			convey.Convey(testCase.name, func() {
+				app := New()
+				var err error
+				app.GET("/", func(ctx *Context) {
+					err = ctx.Render(http.StatusCreated, testCase.render)
+				})
+
+				w := httptest.NewRecorder()
+				app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+				convey.So(err != nil, convey.ShouldEqual, testCase.wantErr)
+				convey.So(w.Code, convey.ShouldEqual, testCase.wantStatus)
+				convey.So(w.Header().Get("Content-Type"), convey.ShouldEqual, testCase.wantContentType)
+				convey.So(w.Body.String(), convey.ShouldEqual, testCase.wantBody)
+			})
+		}
+	})
+}
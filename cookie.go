@@ -0,0 +1,184 @@
+package mini_gin
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/WANGgbin/mini_gin/util"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CookieDefaults SetCookie 以及 SetCookieStruct 使用的默认属性，SetCookieStruct 不使用 Secure 以及 HttpOnly
+type CookieDefaults struct {
+	Path     string
+	Domain   string
+	SameSite http.SameSite
+	Secure   bool
+	HttpOnly bool
+}
+
+// ErrInvalidCookie 签名校验失败或者解密失败
+var ErrInvalidCookie = errors.New("invalid cookie")
+
+// cookieKey 由用户提供的密钥派生出的签名密钥以及加密密钥
+type cookieKey struct {
+	signKey []byte
+	aead    cipher.AEAD
+}
+
+func newCookieKey(secret []byte) *cookieKey {
+	util.Assert(len(secret) > 0, "cookie key should not be empty")
+	// 签名与加密使用不同的密钥，任意长度的密钥都可以派生出 32 字节的 AES-256 密钥
+	block, err := aes.NewCipher(deriveKey(secret, "encrypt"))
+	util.Assert(err == nil, "create cipher error: %v", err)
+	aead, err := cipher.NewGCM(block)
+	util.Assert(err == nil, "create gcm error: %v", err)
+	return &cookieKey{
+		signKey: deriveKey(secret, "sign"),
+		aead:    aead,
+	}
+}
+
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// sign 签名包含 cookie 的名称，避免将一个 cookie 的值用于另一个 cookie
+func (k *cookieKey) sign(name, value string) []byte {
+	mac := hmac.New(sha256.New, k.signKey)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// Cookie 获取请求中的 cookie，cookie 不存在时返回 http.ErrNoCookie
+func (ctx *Context) Cookie(name string) (string, error) {
+	ctx.checkAlive()
+	cookie, err := ctx.req.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return url.QueryUnescape(cookie.Value)
+}
+
+// SetCookie 设置 cookie，其他属性使用 Engine.CookieDefaults，maxAge < 0 表示删除 cookie
+func (ctx *Context) SetCookie(name, value string, maxAge int) {
+	ctx.SetCookieStruct(&http.Cookie{
+		Name:     name,
+		Value:    value,
+		MaxAge:   maxAge,
+		Secure:   ctx.e.CookieDefaults.Secure,
+		HttpOnly: ctx.e.CookieDefaults.HttpOnly,
+	})
+}
+
+// SetCookieStruct 设置 cookie，cookie 中未设置的 Path、Domain、SameSite 使用 Engine.CookieDefaults，
+// Secure、HttpOnly 以 cookie 为准，不使用默认属性，eg: 需要 js 读取的 csrf token 可以关闭 HttpOnly。
+// cookie 的值会被转义，通过 Cookie 获取时自动还原
+func (ctx *Context) SetCookieStruct(cookie *http.Cookie) {
+	ctx.checkWritable()
+	defaults := ctx.e.CookieDefaults
+	c := *cookie
+	c.Value = url.QueryEscape(c.Value)
+	if c.Path == "" {
+		c.Path = defaults.Path
+	}
+	if c.Domain == "" {
+		c.Domain = defaults.Domain
+	}
+	if c.SameSite == 0 {
+		c.SameSite = defaults.SameSite
+	}
+	http.SetCookie(ctx.Writer, &c)
+}
+
+// SetSignedCookie 设置使用 HMAC-SHA256 签名的 cookie，客户端可以读取但无法篡改，使用 WithCookieKeys 设置的第一个密钥签名
+func (ctx *Context) SetSignedCookie(name, value string, maxAge int) {
+	key := ctx.primaryCookieKey()
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(value)) + "." +
+		base64.RawURLEncoding.EncodeToString(key.sign(name, value))
+	ctx.SetCookie(name, encoded, maxAge)
+}
+
+// SignedCookie 获取通过 SetSignedCookie 设置的 cookie，依次使用 WithCookieKeys 设置的所有密钥校验签名，
+// 校验失败时返回 ErrInvalidCookie
+func (ctx *Context) SignedCookie(name string) (string, error) {
+	encoded, err := ctx.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	index := strings.IndexByte(encoded, '.')
+	if index == -1 {
+		return "", ErrInvalidCookie
+	}
+	value, err := base64.RawURLEncoding.DecodeString(encoded[:index])
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encoded[index+1:])
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+
+	for _, key := range ctx.cookieKeys() {
+		if hmac.Equal(signature, key.sign(name, string(value))) {
+			return string(value), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+// SetEncryptedCookie 设置使用 AES-GCM 加密的 cookie，客户端无法读取以及篡改，使用 WithCookieKeys 设置的第一个密钥加密
+func (ctx *Context) SetEncryptedCookie(name, value string, maxAge int) error {
+	aead := ctx.primaryCookieKey().aead
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	// cookie 的名称作为附加数据，避免将一个 cookie 的值用于另一个 cookie
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	ctx.SetCookie(name, base64.RawURLEncoding.EncodeToString(sealed), maxAge)
+	return nil
+}
+
+// EncryptedCookie 获取通过 SetEncryptedCookie 设置的 cookie，依次使用 WithCookieKeys 设置的所有密钥解密，
+// 解密失败时返回 ErrInvalidCookie
+func (ctx *Context) EncryptedCookie(name string) (string, error) {
+	encoded, err := ctx.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+	for _, key := range ctx.cookieKeys() {
+		nonceSize := key.aead.NonceSize()
+		if len(sealed) < nonceSize {
+			break
+		}
+		if value, err := key.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(name)); err == nil {
+			return string(value), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+// primaryCookieKey 获取用于签名以及加密的密钥，即 WithCookieKeys 设置的第一个密钥
+func (ctx *Context) primaryCookieKey() *cookieKey {
+	return ctx.cookieKeys()[0]
+}
+
+func (ctx *Context) cookieKeys() []*cookieKey {
+	util.Assert(len(ctx.e.cookieKeys) > 0, "cookie keys should be set by WithCookieKeys before using signed or encrypted cookies")
+	return ctx.e.cookieKeys
+}
@@ -0,0 +1,115 @@
+package mini_gin
+
+import (
+	"github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContext_Cookie(t *testing.T) {
+	convey.Convey("", t, func() {
+		convey.Convey("defaults", func() {
+			app := NewWithCfg(WithCookieDefaults(CookieDefaults{Path: "/", Domain: "example.com", SameSite: http.SameSiteStrictMode, Secure: true}))
+			var got string
+			app.GET("/", func(ctx *Context) {
+				got, _ = ctx.Cookie("name")
+				ctx.SetCookie("session", "a b;c", 3600)
+				ctx.SetCookieStruct(&http.Cookie{Name: "lang", Value: "zh", Path: "/docs", HttpOnly: true})
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(&http.Cookie{Name: "name", Value: "tom%20cat"})
+			app.ServeHTTP(w, req)
+			convey.So(got, convey.ShouldEqual, "tom cat")
+			convey.So(w.Header()["Set-Cookie"], convey.ShouldResemble, []string{
+				"session=a+b%3Bc; Path=/; Domain=example.com; Max-Age=3600; Secure; SameSite=Strict",
+				"lang=zh; Path=/docs; Domain=example.com; HttpOnly; SameSite=Strict",
+			})
+		})
+
+		convey.Convey("struct overrides secure and http only", func() {
+			app := New()
+			app.GET("/", func(ctx *Context) {
+				ctx.SetCookie("session", "1", 0)
+				ctx.SetCookieStruct(&http.Cookie{Name: "csrf", Value: "token", HttpOnly: false})
+			})
+
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			convey.So(w.Header()["Set-Cookie"], convey.ShouldResemble, []string{
+				"session=1; Path=/; HttpOnly; SameSite=Lax",
+				"csrf=token; Path=/; SameSite=Lax",
+			})
+		})
+
+		// 通过 setApp 设置 cookie，再将 cookie 发送给 getApp
+		roundTrip := func(setApp, getApp *Engine, tamper func(c *http.Cookie)) {
+			w := httptest.NewRecorder()
+			setApp.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/set", nil))
+			req := httptest.NewRequest(http.MethodGet, "/get", nil)
+			for _, c := range w.Result().Cookies() {
+				if tamper != nil {
+					tamper(c)
+				}
+				req.AddCookie(c)
+			}
+			getApp.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		testCases := []struct {
+			name      string
+			setKeys   [][]byte
+			getKeys   [][]byte
+			tamper    func(c *http.Cookie)
+			wantValue string
+			wantErr   error
+		}{
+			{name: "valid", setKeys: [][]byte{[]byte("old")}, getKeys: [][]byte{[]byte("old")}, wantValue: "uid=1"},
+			{name: "key rotation", setKeys: [][]byte{[]byte("old")}, getKeys: [][]byte{[]byte("new"), []byte("old")}, wantValue: "uid=1"},
+			{name: "unknown key", setKeys: [][]byte{[]byte("old")}, getKeys: [][]byte{[]byte("new")}, wantErr: ErrInvalidCookie},
+			{name: "tampered", setKeys: [][]byte{[]byte("old")}, getKeys: [][]byte{[]byte("old")}, tamper: func(c *http.Cookie) { c.Value = "x" + c.Value }, wantErr: ErrInvalidCookie},
+		}
+
+		for _, testCase := range testCases {
+			convey.Convey("signed "+testCase.name, func() {
+				setApp := NewWithCfg(WithCookieKeys(testCase.setKeys...))
+				getApp := NewWithCfg(WithCookieKeys(testCase.getKeys...))
+				var value string
+				var err error
+				setApp.GET("/set", func(ctx *Context) { ctx.SetSignedCookie("session", "uid=1", 0) })
+				getApp.GET("/get", func(ctx *Context) { value, err = ctx.SignedCookie("session") })
+
+				roundTrip(setApp, getApp, testCase.tamper)
+				convey.So(value, convey.ShouldEqual, testCase.wantValue)
+				convey.So(err, convey.ShouldEqual, testCase.wantErr)
+			})
+
+			convey.Convey("encrypted "+testCase.name, func() {
+				setApp := NewWithCfg(WithCookieKeys(testCase.setKeys...))
+				getApp := NewWithCfg(WithCookieKeys(testCase.getKeys...))
+				var value, raw string
+				var err error
+				setApp.GET("/set", func(ctx *Context) { _ = ctx.SetEncryptedCookie("session", "uid=1", 0) })
+				getApp.GET("/get", func(ctx *Context) {
+					raw, _ = ctx.Cookie("session")
+					value, err = ctx.EncryptedCookie("session")
+				})
+
+				roundTrip(setApp, getApp, testCase.tamper)
+				convey.So(raw, convey.ShouldNotContainSubstring, "uid")
+				convey.So(value, convey.ShouldEqual, testCase.wantValue)
+				convey.So(err, convey.ShouldEqual, testCase.wantErr)
+			})
+		}
+
+		convey.Convey("without keys", func() {
+			app := New()
+			app.GET("/", func(ctx *Context) {
+				convey.So(func() { ctx.SetSignedCookie("session", "uid=1", 0) }, convey.ShouldPanic)
+			})
+			app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+	})
+}
@@ -1,13 +1,18 @@
 package mini_gin
 
 import (
-	"context"
-	log "github.com/sirupsen/logrus"
+	"github.com/WANGgbin/mini_gin/render"
+	"github.com/WANGgbin/mini_gin/util"
+	"html/template"
+	"io/fs"
+	"net"
 	"net/http"
 	"os"
-	"os/signal"
+	"path"
+	"sort"
+	"strings"
 	"sync"
-	"syscall"
+	"time"
 )
 
 func New() *Engine {
@@ -16,172 +21,472 @@ func New() *Engine {
 
 func NewWithCfg(opts ...EngineOption) *Engine {
 	options := NewEngineOptions(opts...)
-	engine := &Engine{
-		server: &http.Server{
+	server := options.Server
+	if server == nil {
+		server = &http.Server{
 			Addr:              options.Addr,
 			ReadTimeout:       options.ReadTimeout,
 			ReadHeaderTimeout: options.ReadHeaderTimeout,
 			WriteTimeout:      options.WriteTimeout,
 			IdleTimeout:       options.IdlTimeout,
-		},
+		}
+	} else if server.Addr == "" {
+		server.Addr = options.Addr
+	}
+	engine := &Engine{
+		server: server,
 		rootRouteGroup: &RouteGroup{
 			basePrefix: "/",
 		},
-		method2routes: map[string]*trieTree{
-			http.MethodGet:    newTrieTree(),
-			http.MethodPost:   newTrieTree(),
-			http.MethodPut:    newTrieTree(),
-			http.MethodDelete: newTrieTree(),
-		},
-		ctxPool: sync.Pool{
-			New: newContext,
-		},
+		method2routes:          newMethodTrees(),
+		staticHosts:            make(map[string]*hostRoutes),
+		namedRoutes:            make(map[string]*Route),
 		HandleMethodNotAllowed: options.HandleMethodNotAllowed,
+		HandleOptions:          options.HandleOptions,
+		RedirectTrailingSlash:  options.RedirectTrailingSlash,
+		RedirectFixedPath:      options.RedirectFixedPath,
+		Debug:                  options.Debug,
+		ContextWithFallback:    options.ContextWithFallback,
+		MaxMultipartMemory:     options.MaxMultipartMemory,
+		CookieDefaults:         options.CookieDefaults,
+		SecureJSONPrefix:       options.SecureJSONPrefix,
+		shutdownTimeout:        options.ShutdownTimeout,
+		unixSocketMode:         options.UnixSocketMode,
+		serve:                  newServeState(),
+		gracefulRestart:        options.GracefulRestart,
+		listenKeys:             make(map[net.Listener]string),
+	}
+
+	for _, secret := range options.CookieKeys {
+		engine.cookieKeys = append(engine.cookieKeys, newCookieKey(secret))
 	}
 
 	engine.rootRouteGroup.engine = engine
+	engine.rootRouteGroup.trees = engine.method2routes
+	engine.ctxPool.New = func() interface{} {
+		return newContext(engine.maxParams)
+	}
 
 	return engine
 }
 
+// Engine 实现了 http.Handler，可以直接作为 handler 使用，eg: http.ListenAndServe(":8080", engine)
+var _ http.Handler = (*Engine)(nil)
+
+// anyMethods 所有标准的 http 方法，Any 会在这些方法上注册路由
+var anyMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
 type Engine struct {
 	server         *http.Server
 	rootRouteGroup *RouteGroup
-	method2routes  map[string]*trieTree
+	// method2routes 默认的路由，请求的 host 未匹配任何 host 模式或者 host 中不存在请求的路由时使用
+	method2routes methodTrees
+	// 按照 host 模式注册的路由，hosts 按照注册顺序记录所有的 host 模式
+	hosts         []*hostRoutes
+	staticHosts   map[string]*hostRoutes
+	wildCardHosts []*hostRoutes
 
 	// 对于每条链接都会使用到的结构体类型，使用池化技术减少内存的分配次数，进而提高系统性能
 	ctxPool sync.Pool
+	// 所有路由中动态参数数量的最大值，用于预先分配 Context 中 params 的容量
+	maxParams int
+
+	// namedRoutes 路由名到路由的映射，用于根据路由名反向生成 url
+	namedRoutes map[string]*Route
 
+	// 用户自定义的 路由未命中/方法不支持 时的处理逻辑
 	noRoute  []MiddleWare
 	noMethod []MiddleWare
+	// 编译后的完整 handlers，包括全局中间件以及默认的处理逻辑
+	allNoRoute  []MiddleWare
+	allNoMethod []MiddleWare
+	// options 自动响应 OPTIONS 请求时使用的 handlers
+	options []MiddleWare
 
-	// 设置为 true，当某个未匹配的路由的另一种方法存在时，返回 Method not allowed
+	// Freeze 之后不能再注册路由以及中间件
+	freezeOnce sync.Once
+	frozen     bool
+
+	// 服务启动前以及关闭后执行的钩子
+	onStart    []Hook
+	onShutdown []Hook
+	// 优雅退出时等待进行中的请求处理完毕的最大时间
+	shutdownTimeout time.Duration
+	shutdownOnce    sync.Once
+	shutdownErr     error
+	// 服务监听的所有端点
+	endpoints []*endpoint
+	// lifecycleMu 保护 started 以及 serve，Wait 可以与 Start 并发调用
+	lifecycleMu sync.Mutex
+	started     bool
+	serve       *serveState
+	// unix socket 文件的权限
+	unixSocketMode os.FileMode
+	// 平滑重启相关：通过 Listen 创建的监听以及对应的 key，父进程传递的监听
+	gracefulRestart bool
+	listenKeys      map[net.Listener]string
+	inherited       map[string]net.Listener
+	inheritOnce     sync.Once
+
+	// Context.HTML 使用的模板，htmlOptions 为 LoadHTMLGlob 等加载模板文件时的选项
+	htmlRender  render.HTMLRender
+	htmlOptions render.HTMLOptions
+
+	// 签名以及加密 cookie 使用的密钥，第一个用于签名以及加密，所有密钥都用于校验以及解密
+	cookieKeys []*cookieKey
+
+	// 设置为 true，当某个未匹配的路由的另一种方法存在时，返回 Method not allowed，并通过 Allow 头部返回支持的方法
 	HandleMethodNotAllowed bool
+	// 设置为 true，当 OPTIONS 请求未匹配用户注册的路由时，自动通过 Allow 头部返回该路由支持的方法
+	HandleOptions bool
+	// 设置为 true，当路由未匹配但增加/删除末尾的 '/' 后可以匹配时，重定向到对应的路由
+	// eg: 注册了 /users，请求 /users/ 会被重定向到 /users
+	RedirectTrailingSlash bool
+	// 设置为 true，当路由未匹配时，清理路由中多余的 '..'、'//' 等，并忽略大小写重新匹配，匹配成功则重定向到修正后的路由
+	// eg: 注册了 /users，请求 /../USERS 会被重定向到 /users
+	RedirectFixedPath bool
+	// 设置为 true，开启 debug 模式，eg: 服务启动时打印所有已注册的路由，请求结束后继续使用 Context 时 panic
+	Debug bool
+	// 设置为 true，Context 作为 context.Context 使用时的 Deadline/Done/Err/Value 使用请求的 context，
+	// 设置为 false 时 Context 没有截止时间并且不会被取消，Value 只返回通过 Set 设置的值
+	ContextWithFallback bool
+	// 解析 multipart 请求时内存中最多保存的数据大小，超出部分保存到临时文件
+	MaxMultipartMemory int64
+	// SetCookie 以及 SetCookieStruct 使用的默认属性，见 CookieDefaults
+	CookieDefaults CookieDefaults
+	// Context.SecureJSON 在 json 前添加的前缀
+	SecureJSONPrefix string
 }
 
+// Use 添加全局中间件，对所有路由生效，包括在此之前注册的路由
 func (e *Engine) Use(mws ...MiddleWare) {
 	e.rootRouteGroup.Append(mws...)
-	e.combineNoRouteHandlers()
-	e.combineNoMethodHandlers()
 }
 
 // NoRoute 用户自定义 路由未命中时的 处理逻辑
 func (e *Engine) NoRoute(mws ...MiddleWare) {
+	e.assertNotFrozen()
 	e.noRoute = mws
-	e.combineNoRouteHandlers()
 }
 
 // NoMethod 用户自定义 方法不支持时的 处理逻辑
 func (e *Engine) NoMethod(mws ...MiddleWare) {
+	e.assertNotFrozen()
 	e.noMethod = mws
-	e.combineNoMethodHandlers()
 }
 
-func (e *Engine) combineNoRouteHandlers() {
-	e.noRoute = e.rootRouteGroup.getHandlers(e.noRoute...)
+// Freeze 根据当前的路由组层级编译所有路由的 handlers，之后不能再注册路由以及中间件。
+// Run 以及首次处理请求时会自动调用，所以中间件与路由的注册顺序不影响结果。
+func (e *Engine) Freeze() {
+	e.freezeOnce.Do(e.freeze)
+}
+
+func (e *Engine) freeze() {
+	e.frozen = true
+
+	compile := func(_ string, n *node) {
+		if n.route != nil {
+			n.handlers = n.route.getHandlers()
+		}
+	}
+	for _, tree := range e.method2routes {
+		tree.walk(compile)
+	}
+	for _, host := range e.hosts {
+		for _, tree := range host.trees {
+			tree.walk(compile)
+		}
+	}
+
+	e.allNoRoute = append(e.rootRouteGroup.getHandlers(e.noRoute...), notFoundHandler)
+	e.allNoMethod = append(e.rootRouteGroup.getHandlers(e.noMethod...), methodNotAllowedHandler)
+	// OPTIONS 请求同样需要经过全局中间件，eg: CORS 中间件处理预检请求
+	e.options = e.rootRouteGroup.getHandlers(optionsHandler)
 }
 
-func (e *Engine) combineNoMethodHandlers() {
-	e.noMethod = e.rootRouteGroup.getHandlers(e.noMethod...)
+func (e *Engine) assertNotFrozen() {
+	util.Assert(!e.frozen, "engine has been frozen, middlewares and routes should be registered before serving")
 }
 
 // ServeHTTP 实现 http.Handler
 func (e *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	routeInfo := e.getRouteInfo(req.Method, req.URL.Path)
+	e.Freeze()
 	ctx := e.ctxPool.Get().(*Context)
 	ctx.setEngine(e).setRespWriter(w).setRequest(req)
+	e.handleRequest(ctx)
+	ctx.reset()
+	// 检测 Context 在请求结束后是否被继续使用：Context 不再复用，之后使用会 panic
+	if e.Debug || raceEnabled {
+		ctx.released = true
+		return
+	}
+	e.ctxPool.Put(ctx)
+}
 
-	if routeInfo == nil {
-		var hasSetHandlers bool
-		if e.HandleMethodNotAllowed {
-			for method := range e.method2routes {
-				if method == req.Method {
-					continue
-				}
-				routeInfo = e.getRouteInfo(method, req.URL.Path)
-				if routeInfo != nil {
-					hasSetHandlers = true
-					ctx.setHandlersOnRouteNotHit(http.StatusMethodNotAllowed)
-				}
-			}
+func (e *Engine) handleRequest(ctx *Context) {
+	req := ctx.req
+	// 匹配的 host 中不存在请求的路由时回退到默认路由树，eg: 所有 host 共用的健康检查、静态文件，
+	// 重定向以及 Allow 同样依次使用 host 以及默认的路由树
+	treesList := []methodTrees{e.method2routes}
+	if host := e.matchHost(req.Host, &ctx.params); host != nil {
+		treesList = []methodTrees{host.trees, e.method2routes}
+	}
+	for idx, trees := range treesList {
+		numOfHostParams := len(ctx.params)
+		n := trees.getRoute(req.Method, req.URL.Path, &ctx.params)
+		if n == nil {
+			continue
 		}
-		if !hasSetHandlers {
-			ctx.setHandlersOnRouteNotHit(http.StatusNotFound)
+		// 命中默认路由树时不保留 host 中的参数
+		if idx > 0 {
+			ctx.params = append(ctx.params[:0], ctx.params[numOfHostParams:]...)
 		}
+		ctx.setHandlers(n.handlers)
+		ctx.fullPath = n.fullPath
+		ctx.Next()
+		return
+	}
+
+	for _, trees := range treesList {
+		if e.redirect(ctx, trees) {
+			return
+		}
+	}
+
+	var allow string
+	if e.HandleOptions || e.HandleMethodNotAllowed {
+		allow = e.getAllowedMethods(treesList, req.Method, req.URL.Path, &ctx.params)
+	}
+
+	if allow != "" && e.HandleOptions && req.Method == http.MethodOptions {
+		ctx.SetHeader("Allow", allow)
+		ctx.setHandlers(e.options)
+	} else if allow != "" && e.HandleMethodNotAllowed {
+		ctx.SetHeader("Allow", allow)
+		ctx.setHandlersOnRouteNotHit(http.StatusMethodNotAllowed)
 	} else {
-		ctx.setHandlers(routeInfo.handlers)
-		ctx.setParams(routeInfo.params)
+		ctx.setHandlersOnRouteNotHit(http.StatusNotFound)
 	}
 	ctx.Next()
-	ctx.reset()
-	e.ctxPool.Put(ctx)
 }
 
-// Run 基于 net/http 实现
-func (e *Engine) Run() {
-	e.server.Handler = e
+// redirect 路由未命中时，尝试修正路由并重定向，重定向成功返回 true
+func (e *Engine) redirect(ctx *Context, trees methodTrees) bool {
+	w, req := ctx.Writer, ctx.req
+	route := req.URL.Path
+	if req.Method == http.MethodConnect || route == "/" {
+		return false
+	}
 
-	// 服务器异常退出
-	errCh := make(chan error, 1)
-	go func() {
-		if err := e.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			errCh <- err
+	tree := trees[req.Method]
+	if tree == nil {
+		return false
+	}
+
+	if e.RedirectTrailingSlash {
+		// 清理多余的 '/'，避免 //evil.com/ 被重定向到 //evil.com 这种指向其他站点的地址
+		fixedRoute := cleanPath(toggleTrailingSlash(route))
+		length := len(ctx.params)
+		found := tree.getRouteInfo(fixedRoute, &ctx.params) != nil
+		ctx.params = ctx.params[:length]
+		if found && isLocalRedirect(fixedRoute) {
+			redirectTo(w, req, fixedRoute)
+			return true
 		}
-	}()
-	sigCh := make(chan os.Signal)
-	// SIGQUIT: 优雅退出
-	// SIGTERM: 强制退出
-	signal.Notify(sigCh, syscall.SIGQUIT, syscall.SIGTERM)
-	select {
-	case err := <-errCh:
-		log.Errorf("Server exit unexpectedly, error: %v", err)
-	case sig := <-sigCh:
-		if sig == syscall.SIGTERM {
-			if err := e.server.Close(); err != nil {
-				log.Errorf("Close server error: %v", err)
-			} else {
-				log.Infof("Close server")
+	}
+
+	if e.RedirectFixedPath {
+		fixedRoute, found := tree.findCaseInsensitivePath(cleanPath(route), e.RedirectTrailingSlash)
+		if found && fixedRoute != route && isLocalRedirect(fixedRoute) {
+			redirectTo(w, req, fixedRoute)
+			return true
+		}
+	}
+	return false
+}
+
+// isLocalRedirect route 是否指向当前站点，浏览器会将 //host 以及 /\host 作为其他站点的地址
+func isLocalRedirect(route string) bool {
+	return !strings.HasPrefix(route, "//") && !strings.HasPrefix(route, "/\\")
+}
+
+// redirectTo GET 请求使用 301，其他请求使用 308 保证重定向后 method 以及 body 不变
+func redirectTo(w http.ResponseWriter, req *http.Request, route string) {
+	status := http.StatusMovedPermanently
+	if req.Method != http.MethodGet {
+		status = http.StatusPermanentRedirect
+	}
+
+	if req.URL.RawQuery != "" {
+		route += "?" + req.URL.RawQuery
+	}
+	http.Redirect(w, req, route, status)
+}
+
+// cleanPath 同 path.Clean，但是保留末尾的 '/'
+func cleanPath(route string) string {
+	if route == "" {
+		return "/"
+	}
+
+	cleaned := path.Clean("/" + route)
+	if route[len(route)-1] == '/' && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// getAllowedMethods 获取 treesList 中 route 支持的所有方法(不包括 reqMethod)，用于设置 Allow 头部，不存在返回空字符串。
+// route 为 '*' 时，表示整个服务器支持的方法。
+func (e *Engine) getAllowedMethods(treesList []methodTrees, reqMethod, route string, params *Params) string {
+	var allowed []string
+	var hasOptions bool
+	found := make(map[string]bool)
+	length := len(*params)
+	for _, trees := range treesList {
+		for method, tree := range trees {
+			if method == reqMethod || found[method] {
+				continue
 			}
-		} else {
-			// TODO(@wangguobin): 设置优雅退出最大等待时间
-			if err := e.server.Shutdown(context.Background()); err != nil {
-				log.Errorf("Shutdown server error: %v", err)
-			} else {
-				log.Infof("Shutdown server")
+
+			if (route == "*" && !tree.isEmpty()) || (route != "*" && tree.getRouteInfo(route, params) != nil) {
+				found[method] = true
+				allowed = append(allowed, method)
+				hasOptions = hasOptions || method == http.MethodOptions
 			}
+			// 这里只关心路由是否存在，不需要动态参数
+			*params = (*params)[:length]
 		}
 	}
+
+	if len(allowed) == 0 {
+		return ""
+	}
+
+	// 开启了 HandleOptions，OPTIONS 同样是被支持的方法
+	if e.HandleOptions && !hasOptions {
+		allowed = append(allowed, http.MethodOptions)
+	}
+
+	sort.Strings(allowed)
+	return strings.Join(allowed, ", ")
 }
 
 /*
 	Register Routes
 */
 
-func (e *Engine) GET(route string, handler MiddleWare) {
-	e.rootRouteGroup.GET(route, handler)
+func (e *Engine) GET(route string, handler MiddleWare) *Route {
+	return e.rootRouteGroup.GET(route, handler)
 }
 
-func (e *Engine) POST(route string, handler MiddleWare) {
-	e.rootRouteGroup.POST(route, handler)
+func (e *Engine) POST(route string, handler MiddleWare) *Route {
+	return e.rootRouteGroup.POST(route, handler)
 }
 
-func (e *Engine) PUT(route string, handler MiddleWare) {
-	e.rootRouteGroup.PUT(route, handler)
+func (e *Engine) PUT(route string, handler MiddleWare) *Route {
+	return e.rootRouteGroup.PUT(route, handler)
 }
 
-func (e *Engine) DELETE(route string, handler MiddleWare) {
-	e.rootRouteGroup.DELETE(route, handler)
+func (e *Engine) DELETE(route string, handler MiddleWare) *Route {
+	return e.rootRouteGroup.DELETE(route, handler)
 }
 
-func (e *Engine) NewGroup(baseRoute string, handlers ...MiddleWare) *RouteGroup {
-	return newRouteGroup(e, baseRoute, handlers...)
+func (e *Engine) PATCH(route string, handler MiddleWare) *Route {
+	return e.rootRouteGroup.PATCH(route, handler)
 }
 
-func (e *Engine) getRouteInfo(method, route string) *pathInfo {
-	tree := e.method2routes[method]
-	if tree == nil {
-		return nil
-	}
+func (e *Engine) HEAD(route string, handler MiddleWare) *Route {
+	return e.rootRouteGroup.HEAD(route, handler)
+}
+
+func (e *Engine) OPTIONS(route string, handler MiddleWare) *Route {
+	return e.rootRouteGroup.OPTIONS(route, handler)
+}
+
+func (e *Engine) CONNECT(route string, handler MiddleWare) *Route {
+	return e.rootRouteGroup.CONNECT(route, handler)
+}
 
-	return tree.getRouteInfo(route)
+func (e *Engine) TRACE(route string, handler MiddleWare) *Route {
+	return e.rootRouteGroup.TRACE(route, handler)
+}
+
+func (e *Engine) Handle(method, route string, handlers ...MiddleWare) *Route {
+	return e.rootRouteGroup.Handle(method, route, handlers...)
+}
+
+func (e *Engine) Any(route string, handlers ...MiddleWare) *Route {
+	return e.rootRouteGroup.Any(route, handlers...)
+}
+
+// SetHTMLTemplate 设置 Context.HTML 使用的模板
+func (e *Engine) SetHTMLTemplate(tmpl *template.Template) {
+	e.htmlRender = render.HTMLTemplate(tmpl)
+}
+
+// SetFuncMap 设置模板中可以使用的函数，需要在 LoadHTMLGlob 等加载模板文件之前调用
+func (e *Engine) SetFuncMap(funcMap template.FuncMap) {
+	e.htmlOptions.FuncMap = funcMap
+}
+
+// Delims 设置模板的分隔符，默认为 {{ 与 }}，需要在 LoadHTMLGlob 等加载模板文件之前调用
+func (e *Engine) Delims(left, right string) {
+	e.htmlOptions.LeftDelim = left
+	e.htmlOptions.RightDelim = right
+}
+
+// SetHTMLLayout 设置布局模板 layout 以及所有页面共用的模板 partials，需要在 LoadHTMLGlob 等加载模板文件之前调用。
+// layout 以及 partials 为模板文件名，除此之外的模板文件都作为页面，Context.HTML 渲染页面时执行 layout，
+// 页面通过 {{define "name"}} 覆盖 layout 中的 {{block "name" .}}，eg:
+// SetHTMLLayout("base.html", "nav.html") 后 LoadHTMLGlob("templates/*.html")，Context.HTML(200, "index.html", data)
+func (e *Engine) SetHTMLLayout(layout string, partials ...string) {
+	e.htmlOptions.Layout = layout
+	e.htmlOptions.Partials = partials
+}
+
+// LoadHTMLGlob 加载 pattern 匹配的模板文件，模板名称为文件名。Debug 模式下，模板文件修改后重新加载，不需要重启服务
+func (e *Engine) LoadHTMLGlob(pattern string) {
+	h, err := render.LoadHTMLGlob(pattern, e.htmlLoadOptions())
+	util.Assert(err == nil, "load html templates failed: %v", err)
+	e.htmlRender = h
+}
+
+// LoadHTMLFiles 加载模板文件，同 LoadHTMLGlob
+func (e *Engine) LoadHTMLFiles(files ...string) {
+	h, err := render.LoadHTMLFiles(e.htmlLoadOptions(), files...)
+	util.Assert(err == nil, "load html templates failed: %v", err)
+	e.htmlRender = h
+}
+
+// LoadHTMLFS 加载 fsys 中 patterns 匹配的模板文件，eg: embed.FS，同 LoadHTMLGlob
+func (e *Engine) LoadHTMLFS(fsys fs.FS, patterns ...string) {
+	h, err := render.LoadHTMLFS(fsys, e.htmlLoadOptions(), patterns...)
+	util.Assert(err == nil, "load html templates failed: %v", err)
+	e.htmlRender = h
+}
+
+func (e *Engine) htmlLoadOptions() render.HTMLOptions {
+	opts := e.htmlOptions
+	opts.Reload = e.Debug
+	return opts
+}
+
+// Mount 参考 RouteGroup.Mount
+func (e *Engine) Mount(prefix string, h http.Handler) {
+	e.rootRouteGroup.Mount(prefix, h)
+}
+
+func (e *Engine) NewGroup(baseRoute string, handlers ...MiddleWare) *RouteGroup {
+	return newRouteGroup(e, baseRoute, handlers...)
 }
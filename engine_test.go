@@ -1,9 +1,20 @@
 package mini_gin_test
 
 import (
+	"context"
 	"github.com/WANGgbin/mini_gin"
+	"github.com/smartystreets/goconvey/convey"
+	"html/template"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -54,3 +65,401 @@ func TestRegisterRoute(t *testing.T) {
 	gp.GET("route", mw1)
 	gp.POST("route", mw1)
 }
+
+func TestHandleMethods(t *testing.T) {
+	convey.Convey("", t, func() {
+		app := mini_gin.New()
+		echoMethod := func(ctx *mini_gin.Context) {
+			_, _ = ctx.Write([]byte("ok"))
+		}
+		app.PATCH("/patch", echoMethod)
+		app.Handle("PROPFIND", "/dav/*filepath", echoMethod)
+		app.Any("/any", echoMethod)
+
+		testCases := []struct {
+			method     string
+			route      string
+			wantStatus int
+		}{
+			{method: http.MethodPatch, route: "/patch", wantStatus: http.StatusOK},
+			{method: http.MethodGet, route: "/patch", wantStatus: http.StatusNotFound},
+			{method: "PROPFIND", route: "/dav/a/b", wantStatus: http.StatusOK},
+			{method: http.MethodGet, route: "/any", wantStatus: http.StatusOK},
+			{method: http.MethodTrace, route: "/any", wantStatus: http.StatusOK},
+			{method: "PROPFIND", route: "/any", wantStatus: http.StatusNotFound},
+		}
+
+		for _, testCase := range testCases {
+			convey.Convey(testCase.method+" "+testCase.route, func() {
+				w := httptest.NewRecorder()
+				app.ServeHTTP(w, httptest.NewRequest(testCase.method, testCase.route, nil))
+				convey.So(w.Code, convey.ShouldEqual, testCase.wantStatus)
+				if testCase.wantStatus == http.StatusOK {
+					convey.So(w.Body.String(), convey.ShouldEqual, "ok")
+				}
+			})
+		}
+
+		convey.So(func() { app.Handle("get", "/lower", echoMethod) }, convey.ShouldPanic)
+	})
+}
+
+func TestAllowHeader(t *testing.T) {
+	convey.Convey("", t, func() {
+		app := mini_gin.NewWithCfg(mini_gin.WithHandleMethodNotAllowed(), mini_gin.WithHandleOptions())
+		fakeHandler := func(ctx *mini_gin.Context) {}
+		app.GET("/users/:id", fakeHandler)
+		app.PUT("/users/:id", fakeHandler)
+		app.DELETE("/users/:id", fakeHandler)
+		app.POST("/users", fakeHandler)
+
+		testCases := []struct {
+			method     string
+			route      string
+			wantStatus int
+			wantAllow  string
+		}{
+			{method: http.MethodPost, route: "/users/1", wantStatus: http.StatusMethodNotAllowed, wantAllow: "DELETE, GET, OPTIONS, PUT"},
+			{method: http.MethodOptions, route: "/users/1", wantStatus: http.StatusNoContent, wantAllow: "DELETE, GET, OPTIONS, PUT"},
+			{method: http.MethodOptions, route: "/users", wantStatus: http.StatusNoContent, wantAllow: "OPTIONS, POST"},
+			{method: http.MethodOptions, route: "*", wantStatus: http.StatusNoContent, wantAllow: "DELETE, GET, OPTIONS, POST, PUT"},
+			{method: http.MethodOptions, route: "/not/exist", wantStatus: http.StatusNotFound},
+		}
+
+		for _, testCase := range testCases {
+			convey.Convey(testCase.method+" "+testCase.route, func() {
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest(testCase.method, "/", nil)
+				req.URL.Path = testCase.route
+				app.ServeHTTP(w, req)
+				convey.So(w.Code, convey.ShouldEqual, testCase.wantStatus)
+				convey.So(w.Header().Get("Allow"), convey.ShouldEqual, testCase.wantAllow)
+			})
+		}
+	})
+}
+
+func TestRedirect(t *testing.T) {
+	convey.Convey("", t, func() {
+		app := mini_gin.NewWithCfg(mini_gin.WithRedirectTrailingSlash(), mini_gin.WithRedirectFixedPath())
+		fakeHandler := func(ctx *mini_gin.Context) {}
+		app.GET("/users", fakeHandler)
+		app.GET("/users/:id/profile/", fakeHandler)
+		app.POST("/Orders", fakeHandler)
+		app.GET("/static/*filepath", fakeHandler)
+		app.GET("/:lang/docs", fakeHandler)
+
+		testCases := []struct {
+			method       string
+			route        string
+			wantStatus   int
+			wantLocation string
+		}{
+			{method: http.MethodGet, route: "/users/", wantStatus: http.StatusMovedPermanently, wantLocation: "/users"},
+			{method: http.MethodGet, route: "/users/?page=1", wantStatus: http.StatusMovedPermanently, wantLocation: "/users?page=1"},
+			{method: http.MethodGet, route: "/users/Tom/profile", wantStatus: http.StatusMovedPermanently, wantLocation: "/users/Tom/profile/"},
+			{method: http.MethodGet, route: "/USERS/Tom/Profile/", wantStatus: http.StatusMovedPermanently, wantLocation: "/users/Tom/profile/"},
+			{method: http.MethodGet, route: "/a/../USERS", wantStatus: http.StatusMovedPermanently, wantLocation: "/users"},
+			{method: http.MethodGet, route: "//users//", wantStatus: http.StatusMovedPermanently, wantLocation: "/users"},
+			{method: http.MethodPost, route: "/orders/", wantStatus: http.StatusPermanentRedirect, wantLocation: "/Orders"},
+			{method: http.MethodGet, route: "/static", wantStatus: http.StatusMovedPermanently, wantLocation: "/static/"},
+			{method: http.MethodGet, route: "/not/exist", wantStatus: http.StatusNotFound},
+			// 不能重定向到其他站点
+			{method: http.MethodGet, route: "//evil.com/docs/", wantStatus: http.StatusMovedPermanently, wantLocation: "/evil.com/docs"},
+			{method: http.MethodGet, route: "/\\evil.com/docs/", wantStatus: http.StatusNotFound},
+		}
+
+		for _, testCase := range testCases {
+			convey.Convey(testCase.method+" "+testCase.route, func() {
+				w := httptest.NewRecorder()
+				app.ServeHTTP(w, httptest.NewRequest(testCase.method, testCase.route, nil))
+				convey.So(w.Code, convey.ShouldEqual, testCase.wantStatus)
+				convey.So(w.Header().Get("Location"), convey.ShouldEqual, testCase.wantLocation)
+			})
+		}
+	})
+}
+
+func TestConstraint(t *testing.T) {
+	convey.Convey("", t, func() {
+		app := mini_gin.New()
+		app.GET("/users/:id<int>", func(ctx *mini_gin.Context) {
+			_, _ = ctx.Write([]byte("id: " + ctx.Param("id")))
+		})
+		app.GET("/users/:name<[a-z]+>", func(ctx *mini_gin.Context) {
+			_, _ = ctx.Write([]byte("name: " + ctx.Param("name")))
+		})
+
+		testCases := []struct {
+			route      string
+			wantStatus int
+			wantBody   string
+		}{
+			{route: "/users/42", wantStatus: http.StatusOK, wantBody: "id: 42"},
+			{route: "/users/tom", wantStatus: http.StatusOK, wantBody: "name: tom"},
+			{route: "/users/Tom42", wantStatus: http.StatusNotFound, wantBody: "Not Found"},
+		}
+
+		for _, testCase := range testCases {
+			convey.Convey(testCase.route, func() {
+				w := httptest.NewRecorder()
+				app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, testCase.route, nil))
+				convey.So(w.Code, convey.ShouldEqual, testCase.wantStatus)
+				convey.So(w.Body.String(), convey.ShouldEqual, testCase.wantBody)
+			})
+		}
+	})
+}
+
+func TestHost(t *testing.T) {
+	convey.Convey("", t, func() {
+		app := mini_gin.New()
+		writeRoute := func(name string) mini_gin.MiddleWare {
+			return func(ctx *mini_gin.Context) {
+				_, _ = ctx.Write([]byte(name + " " + ctx.Param(mini_gin.HostWildCardParam) + ctx.Param("app") + ctx.Param("id")))
+			}
+		}
+		app.GET("/users/:id", writeRoute("default"))
+		app.Host("api.example.com").GET("/users/:id", writeRoute("api"))
+		app.Host("*.tenant.example.com").GET("/users/:id", writeRoute("tenant"))
+		app.Host(":app.admin.example.com").GET("/users/:id", writeRoute("admin"))
+		// 所有 host 共用默认路由树中的路由
+		app.GET("/health", writeRoute("health"))
+
+		testCases := []struct {
+			host       string
+			route      string
+			wantStatus int
+			wantBody   string
+		}{
+			{route: "/users/1", host: "api.example.com", wantStatus: http.StatusOK, wantBody: "api 1"},
+			{route: "/users/1", host: "API.example.com:8080", wantStatus: http.StatusOK, wantBody: "api 1"},
+			{route: "/users/1", host: "a.tenant.example.com", wantStatus: http.StatusOK, wantBody: "tenant a1"},
+			{route: "/users/1", host: "a.b.tenant.example.com", wantStatus: http.StatusOK, wantBody: "tenant a.b1"},
+			{route: "/users/1", host: "tenant.example.com", wantStatus: http.StatusOK, wantBody: "default 1"},
+			{route: "/users/1", host: "blog.admin.example.com", wantStatus: http.StatusOK, wantBody: "admin blog1"},
+			{route: "/users/1", host: "a.blog.admin.example.com", wantStatus: http.StatusOK, wantBody: "default 1"},
+			{route: "/users/1", host: "example.com", wantStatus: http.StatusOK, wantBody: "default 1"},
+			{route: "/health", host: "api.example.com", wantStatus: http.StatusOK, wantBody: "health "},
+			{route: "/health", host: "a.tenant.example.com", wantStatus: http.StatusOK, wantBody: "health "},
+			{route: "/health", host: "blog.admin.example.com", wantStatus: http.StatusOK, wantBody: "health "},
+			{route: "/missing", host: "api.example.com", wantStatus: http.StatusNotFound, wantBody: "Not Found"},
+		}
+
+		for _, testCase := range testCases {
+			convey.Convey(testCase.host+testCase.route, func() {
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodGet, testCase.route, nil)
+				req.Host = testCase.host
+				app.ServeHTTP(w, req)
+				convey.So(w.Code, convey.ShouldEqual, testCase.wantStatus)
+				convey.So(w.Body.String(), convey.ShouldEqual, testCase.wantBody)
+			})
+		}
+
+		convey.So(func() { app.Host("api.*.example.com") }, convey.ShouldPanic)
+
+		convey.Convey("fallback redirect and allow", func() {
+			app := mini_gin.NewWithCfg(mini_gin.WithHandleMethodNotAllowed(), mini_gin.WithHandleOptions(), mini_gin.WithRedirectTrailingSlash())
+			app.GET("/health", writeRoute("health"))
+			app.Host("api.example.com").PUT("/health", writeRoute("api"))
+
+			testCases := []struct {
+				method       string
+				route        string
+				wantStatus   int
+				wantAllow    string
+				wantLocation string
+			}{
+				{method: http.MethodPost, route: "/health", wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, OPTIONS, PUT"},
+				{method: http.MethodOptions, route: "/health", wantStatus: http.StatusNoContent, wantAllow: "GET, OPTIONS, PUT"},
+				{method: http.MethodGet, route: "/health/", wantStatus: http.StatusMovedPermanently, wantLocation: "/health"},
+			}
+			for _, testCase := range testCases {
+				convey.Convey(testCase.method+" "+testCase.route, func() {
+					w := httptest.NewRecorder()
+					req := httptest.NewRequest(testCase.method, testCase.route, nil)
+					req.Host = "api.example.com"
+					app.ServeHTTP(w, req)
+					convey.So(w.Code, convey.ShouldEqual, testCase.wantStatus)
+					convey.So(w.Header().Get("Allow"), convey.ShouldEqual, testCase.wantAllow)
+					convey.So(w.Header().Get("Location"), convey.ShouldEqual, testCase.wantLocation)
+				})
+			}
+		})
+	})
+}
+
+func TestMount(t *testing.T) {
+	convey.Convey("", t, func() {
+		app := mini_gin.New()
+		legacy := http.NewServeMux()
+		legacy.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+			_, _ = w.Write([]byte("legacy " + req.URL.Path + " " + req.URL.RawQuery))
+		})
+		app.Mount("/legacy", legacy)
+		app.NewGroup("/tenants/:tenant").Mount("/", legacy)
+		app.GET("/wrap", mini_gin.WrapF(func(w http.ResponseWriter, req *http.Request) {
+			_, _ = w.Write([]byte("wrap"))
+		}))
+
+		testCases := []struct {
+			method   string
+			route    string
+			wantBody string
+		}{
+			{method: http.MethodGet, route: "/legacy", wantBody: "legacy / "},
+			{method: http.MethodGet, route: "/legacy/", wantBody: "legacy / "},
+			{method: http.MethodPost, route: "/legacy/users?page=1", wantBody: "legacy /users page=1"},
+			{method: http.MethodGet, route: "/tenants/a/users/1", wantBody: "legacy /users/1 "},
+			{method: http.MethodGet, route: "/wrap", wantBody: "wrap"},
+		}
+
+		for _, testCase := range testCases {
+			convey.Convey(testCase.method+" "+testCase.route, func() {
+				w := httptest.NewRecorder()
+				app.ServeHTTP(w, httptest.NewRequest(testCase.method, testCase.route, nil))
+				convey.So(w.Body.String(), convey.ShouldEqual, testCase.wantBody)
+			})
+		}
+	})
+}
+
+func TestWithServer(t *testing.T) {
+	convey.Convey("", t, func() {
+		server := &http.Server{ReadTimeout: time.Second}
+		app := mini_gin.NewWithCfg(mini_gin.WithServer(server))
+		app.GET("/ping", func(ctx *mini_gin.Context) {
+			_, _ = ctx.Write([]byte("pong"))
+		})
+		ln, _ := net.Listen("tcp", "127.0.0.1:0")
+		app.AddListener(ln)
+		convey.So(app.Start(), convey.ShouldBeNil)
+		convey.So(server.Handler, convey.ShouldEqual, app)
+
+		resp, err := http.Get("http://" + ln.Addr().String() + "/ping")
+		convey.So(err, convey.ShouldBeNil)
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		convey.So(string(body), convey.ShouldEqual, "pong")
+
+		convey.So(app.Shutdown(context.Background()), convey.ShouldBeNil)
+		convey.So(app.Wait(), convey.ShouldBeNil)
+	})
+}
+
+func TestLoadHTML(t *testing.T) {
+	convey.Convey("", t, func() {
+		dir := t.TempDir()
+		files := map[string]string{
+			"base.html":  `<html>{{block "title" .}}default{{end}}|{{block "content" .}}{{end}}|{{template "nav.html"}}</html>`,
+			"nav.html":   `<nav>{{upper "home"}}</nav>`,
+			"index.html": `{{define "title"}}index{{end}}{{define "content"}}hi {{.}}{{end}}`,
+			"about.html": `{{define "content"}}about{{end}}`,
+		}
+		for name, content := range files {
+			convey.So(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644), convey.ShouldBeNil)
+		}
+		funcMap := template.FuncMap{"upper": strings.ToUpper}
+
+		// 使用 name 渲染 data，返回状态码以及响应体
+		render := func(app *mini_gin.Engine, name string, data interface{}) (int, string) {
+			app.GET("/"+name, func(ctx *mini_gin.Context) {
+				_ = ctx.HTML(http.StatusOK, name, data)
+			})
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+name, nil))
+			return w.Code, w.Body.String()
+		}
+
+		convey.Convey("glob", func() {
+			app := mini_gin.New()
+			app.SetFuncMap(funcMap)
+			app.LoadHTMLGlob(filepath.Join(dir, "nav.html"))
+			_, body := render(app, "nav.html", nil)
+			convey.So(body, convey.ShouldEqual, "<nav>HOME</nav>")
+		})
+
+		convey.Convey("delims", func() {
+			convey.So(ioutil.WriteFile(filepath.Join(dir, "delims.html"), []byte(`<p>[[.]]{{.}}</p>`), 0644), convey.ShouldBeNil)
+			app := mini_gin.New()
+			app.Delims("[[", "]]")
+			app.LoadHTMLFiles(filepath.Join(dir, "delims.html"))
+			_, body := render(app, "delims.html", "<tom>")
+			convey.So(body, convey.ShouldEqual, "<p>&lt;tom&gt;{{.}}</p>")
+		})
+
+		convey.Convey("layout", func() {
+			app := mini_gin.New()
+			app.SetFuncMap(funcMap)
+			app.SetHTMLLayout("base.html", "nav.html")
+			app.LoadHTMLGlob(filepath.Join(dir, "*.html"))
+
+			testCases := []struct {
+				name       string
+				wantStatus int
+				wantBody   string
+			}{
+				{name: "index.html", wantStatus: http.StatusOK, wantBody: "<html>index|hi &lt;tom&gt;|<nav>HOME</nav></html>"},
+				{name: "about.html", wantStatus: http.StatusOK, wantBody: "<html>default|about|<nav>HOME</nav></html>"},
+				{name: "nav.html", wantStatus: http.StatusOK, wantBody: "<nav>HOME</nav>"},
+				{name: "missing.html", wantStatus: http.StatusInternalServerError, wantBody: ""},
+			}
+			for _, testCase := range testCases {
+				convey.Convey(testCase.name, func() {
+					status, body := render(app, testCase.name, "<tom>")
+					convey.So(status, convey.ShouldEqual, testCase.wantStatus)
+					convey.So(body, convey.ShouldEqual, testCase.wantBody)
+				})
+			}
+		})
+
+		convey.Convey("fs", func() {
+			fsys := fstest.MapFS{}
+			for name, content := range files {
+				fsys["templates/"+name] = &fstest.MapFile{Data: []byte(content)}
+			}
+			app := mini_gin.New()
+			app.SetFuncMap(funcMap)
+			app.SetHTMLLayout("base.html", "nav.html")
+			app.LoadHTMLFS(fsys, "templates/*.html")
+			_, body := render(app, "index.html", "tom")
+			convey.So(body, convey.ShouldEqual, "<html>index|hi tom|<nav>HOME</nav></html>")
+		})
+
+		convey.Convey("load failed", func() {
+			app := mini_gin.New()
+			convey.So(func() { app.LoadHTMLGlob(filepath.Join(dir, "*.tmpl")) }, convey.ShouldPanic)
+			app.SetHTMLLayout("layout.html")
+			convey.So(func() { app.LoadHTMLGlob(filepath.Join(dir, "*.html")) }, convey.ShouldPanic)
+		})
+
+		convey.Convey("reload", func() {
+			testCases := []struct {
+				name     string
+				opts     []mini_gin.EngineOption
+				wantBody string
+			}{
+				{name: "debug", opts: []mini_gin.EngineOption{mini_gin.WithDebug()}, wantBody: "<p>v2</p>"},
+				{name: "release", wantBody: "<p>v1</p>"},
+			}
+			for _, testCase := range testCases {
+				convey.Convey(testCase.name, func() {
+					file := filepath.Join(dir, "reload.html")
+					convey.So(ioutil.WriteFile(file, []byte(`<p>v1</p>`), 0644), convey.ShouldBeNil)
+					app := mini_gin.NewWithCfg(testCase.opts...)
+					app.LoadHTMLFiles(file)
+					_, body := render(app, "reload.html", nil)
+					convey.So(body, convey.ShouldEqual, "<p>v1</p>")
+
+					convey.So(ioutil.WriteFile(file, []byte(`<p>v2</p>`), 0644), convey.ShouldBeNil)
+					modTime := time.Now().Add(time.Minute)
+					convey.So(os.Chtimes(file, modTime, modTime), convey.ShouldBeNil)
+					w := httptest.NewRecorder()
+					app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/reload.html", nil))
+					convey.So(w.Body.String(), convey.ShouldEqual, testCase.wantBody)
+				})
+			}
+		})
+	})
+}
@@ -5,4 +5,5 @@ go 1.16
 require (
 	github.com/sirupsen/logrus v1.9.3
 	github.com/smartystreets/goconvey v1.7.0
+	gopkg.in/yaml.v3 v3.0.1
 )
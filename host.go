@@ -0,0 +1,193 @@
+package mini_gin
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HostWildCardParam host 模式中 '*' 匹配的子域名对应的参数名
+// eg: *.tenant.example.com 匹配 a.b.tenant.example.com 时，ctx.Param(HostWildCardParam) 为 a.b
+const HostWildCardParam = "subdomain"
+
+// methodTrees 每个 method 对应一颗路由树
+type methodTrees map[string]*trieTree
+
+func newMethodTrees() methodTrees {
+	trees := make(methodTrees, len(anyMethods))
+	for _, method := range anyMethods {
+		trees[method] = newTrieTree()
+	}
+	return trees
+}
+
+// getOrCreate 获取 method 对应的路由树，不存在则创建
+func (trees methodTrees) getOrCreate(method string) *trieTree {
+	tree := trees[method]
+	if tree == nil {
+		tree = newTrieTree()
+		trees[method] = tree
+	}
+	return tree
+}
+
+// getRoute 获取与 method、route 匹配的路由节点，未找到返回 nil
+func (trees methodTrees) getRoute(method, route string, params *Params) *node {
+	tree := trees[method]
+	if tree == nil {
+		return nil
+	}
+
+	return tree.getRoute(route, params)
+}
+
+// hostRoutes 某个 host 模式对应的所有路由
+// host 模式由 '.' 分隔的 label 组成，每个 label 可以是：
+// 1. 静态 label，忽略大小写匹配
+// 2. ':key'，匹配一个 label，并作为参数 key 的值
+// 3. '*'，只能是最左侧的 label，匹配一个或多个 label，并作为参数 HostWildCardParam 的值
+type hostRoutes struct {
+	pattern string
+	labels  []string
+	trees   methodTrees
+}
+
+func newHostRoutes(pattern string) *hostRoutes {
+	pattern = strings.ToLower(pattern)
+	labels := strings.Split(pattern, ".")
+	for idx, label := range labels {
+		if label == "" || (label[0] == ':' && len(label) == 1) {
+			panic(fmt.Sprintf("host pattern %s is invalid, label should not be empty", pattern))
+		}
+		if strings.Contains(label, "*") && (label != "*" || idx != 0) {
+			panic(fmt.Sprintf("host pattern %s is invalid, '*' can only be used as the leftmost label", pattern))
+		}
+	}
+
+	return &hostRoutes{
+		pattern: pattern,
+		labels:  labels,
+		trees:   make(methodTrees),
+	}
+}
+
+// isStatic host 模式中不包含通配符
+func (h *hostRoutes) isStatic() bool {
+	return !strings.ContainsAny(h.pattern, ":*")
+}
+
+// numOfParams host 模式中参数的数量
+func (h *hostRoutes) numOfParams() int {
+	var num int
+	for _, label := range h.labels {
+		if label[0] == ':' || label == "*" {
+			num++
+		}
+	}
+	return num
+}
+
+// match 从右向左逐个 label 匹配 host，host 中的参数追加到 params，匹配失败时 params 恢复为调用前的状态
+func (h *hostRoutes) match(host string, params *Params) bool {
+	length := len(*params)
+	rest := host
+	for idx := len(h.labels) - 1; idx >= 0; idx-- {
+		label := h.labels[idx]
+		if rest == "" {
+			*params = (*params)[:length]
+			return false
+		}
+
+		if label == "*" {
+			*params = append(*params, Param{Key: HostWildCardParam, Value: rest})
+			return true
+		}
+
+		index := strings.LastIndexByte(rest, '.')
+		value := rest[index+1:]
+		if label[0] == ':' {
+			*params = append(*params, Param{Key: label[1:], Value: value})
+		} else if label != value {
+			*params = (*params)[:length]
+			return false
+		}
+
+		if index == -1 {
+			rest = ""
+		} else {
+			// 剩余部分不能以 '.' 结尾
+			rest = rest[:index]
+			if rest == "" {
+				*params = (*params)[:length]
+				return false
+			}
+		}
+	}
+
+	if rest != "" {
+		*params = (*params)[:length]
+		return false
+	}
+	return true
+}
+
+// Host 创建一个只匹配 host 模式的路由组，host 模式的语法见 hostRoutes。
+// 请求的 host 优先匹配静态的 host 模式，其次按照注册顺序匹配带有通配符的 host 模式，都未匹配时使用默认的路由。
+// 匹配的 host 中不存在请求的路由时，同样回退到默认的路由，重定向以及 Allow 头部也会考虑默认的路由。
+func (e *Engine) Host(pattern string, handlers ...MiddleWare) *RouteGroup {
+	host := e.getOrCreateHostRoutes(pattern)
+	return &RouteGroup{
+		engine:       e,
+		parent:       e.rootRouteGroup,
+		host:         host,
+		trees:        host.trees,
+		basePrefix:   "/",
+		baseHandlers: handlers,
+	}
+}
+
+func (e *Engine) getOrCreateHostRoutes(pattern string) *hostRoutes {
+	newHost := newHostRoutes(pattern)
+	if host, ok := e.staticHosts[newHost.pattern]; ok {
+		return host
+	}
+	for _, host := range e.wildCardHosts {
+		if host.pattern == newHost.pattern {
+			return host
+		}
+	}
+
+	if newHost.isStatic() {
+		e.staticHosts[newHost.pattern] = newHost
+	} else {
+		e.wildCardHosts = append(e.wildCardHosts, newHost)
+	}
+	e.hosts = append(e.hosts, newHost)
+	return newHost
+}
+
+// matchHost 获取与请求的 host 匹配的 hostRoutes，host 中的参数追加到 params，未匹配任何 host 模式时返回 nil
+func (e *Engine) matchHost(host string, params *Params) *hostRoutes {
+	if len(e.hosts) == 0 {
+		return nil
+	}
+
+	host = strings.ToLower(stripPort(host))
+	if h, ok := e.staticHosts[host]; ok {
+		return h
+	}
+	for _, h := range e.wildCardHosts {
+		if h.match(host, params) {
+			return h
+		}
+	}
+	return nil
+}
+
+// stripPort 去掉 host 中的端口，eg: example.com:8080 => example.com, [::1]:8080 => [::1]
+func stripPort(host string) string {
+	index := strings.LastIndexByte(host, ':')
+	if index == -1 || strings.IndexByte(host[index:], ']') != -1 {
+		return host
+	}
+	return host[:index]
+}
@@ -12,6 +12,18 @@ import (
 
 type MiddleWare func(ctx *Context)
 
+// WrapH 将 http.Handler 转换为 MiddleWare，便于复用基于 net/http 实现的 handler
+func WrapH(h http.Handler) MiddleWare {
+	return func(ctx *Context) {
+		h.ServeHTTP(ctx.Writer, ctx.req)
+	}
+}
+
+// WrapF 将 http.HandlerFunc 转换为 MiddleWare
+func WrapF(f http.HandlerFunc) MiddleWare {
+	return WrapH(f)
+}
+
 // notFoundHandler 返回 404
 func notFoundHandler(ctx *Context) {
 	handleOnRouteNotHit(ctx, http.StatusNotFound)
@@ -21,6 +33,14 @@ func methodNotAllowedHandler(ctx *Context) {
 	handleOnRouteNotHit(ctx, http.StatusMethodNotAllowed)
 }
 
+// optionsHandler 自动响应 OPTIONS 请求，Allow 头部已在路由匹配阶段设置
+func optionsHandler(ctx *Context) {
+	if ctx.Written() {
+		return
+	}
+	ctx.WriteHeaderAndStatus(http.StatusNoContent)
+}
+
 var (
 	defaultBodyOnNotFound         = []byte("Not Found")
 	defaultBodyOnMethodNotAllowed = []byte("Method Not Allowed")
@@ -69,8 +89,10 @@ type LoggerParam struct {
 	Method     string
 	Route      string
 	StatusCode int
-	TimeStamp  time.Time
-	Latency    time.Duration
+	// BodySize 响应 body 的字节数
+	BodySize  int
+	TimeStamp time.Time
+	Latency   time.Duration
 }
 
 type Option func(cfg *LoggerCfg)
@@ -116,7 +138,8 @@ func LoggerMW(ctx *Context) {
 		param := LoggerParam{
 			Method:     ctx.req.Method,
 			Route:      ctx.req.URL.String(),
-			StatusCode: ctx.status,
+			StatusCode: ctx.Writer.Status(),
+			BodySize:   ctx.Writer.Size(),
 			Latency:    time.Now().Sub(start),
 			TimeStamp:  time.Now(),
 		}
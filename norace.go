@@ -0,0 +1,6 @@
+//go:build !race
+// +build !race
+
+package mini_gin
+
+const raceEnabled = false
@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package mini_gin
+
+// raceEnabled 开启 race 检测时同样检测 Context 在请求结束后是否被继续使用
+const raceEnabled = true
@@ -0,0 +1,252 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const htmlContentType = "text/html; charset=utf-8"
+
+// HTMLRender 根据模板名称创建渲染 data 的 Render
+type HTMLRender interface {
+	Instance(name string, data interface{}) Render
+}
+
+// htmlInstance 执行 template 中名为 name 的模板，err 不为空时直接返回 err
+type htmlInstance struct {
+	template *template.Template
+	name     string
+	data     interface{}
+	err      error
+}
+
+func (r *htmlInstance) Render(w http.ResponseWriter) error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.template.ExecuteTemplate(w, r.name, r.data)
+}
+
+func (r *htmlInstance) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", htmlContentType)
+}
+
+// htmlTemplate 使用同一个模板集合渲染
+type htmlTemplate struct {
+	template *template.Template
+}
+
+// HTMLTemplate 返回使用 tmpl 中的模板渲染的 HTMLRender
+func HTMLTemplate(tmpl *template.Template) HTMLRender {
+	return &htmlTemplate{template: tmpl}
+}
+
+func (h *htmlTemplate) Instance(name string, data interface{}) Render {
+	return &htmlInstance{template: h.template, name: name, data: data}
+}
+
+// HTMLOptions 解析模板文件的选项
+type HTMLOptions struct {
+	FuncMap    template.FuncMap
+	LeftDelim  string
+	RightDelim string
+	// Layout 布局模板，为空时所有模板文件解析到同一个模板集合中。
+	// 否则除 Layout 以及 Partials 之外的每个模板文件作为一个页面，基于 Layout 以及 Partials 单独解析，
+	// 渲染页面时执行 Layout，页面通过 {{define "name"}} 覆盖 Layout 中的 {{block "name" .}}
+	Layout string
+	// Partials 所有页面共用的模板，eg: header.html、footer.html
+	Partials []string
+	// Reload 渲染前检查模板文件，文件新增、删除或者修改后重新解析，用于开发时调试模板
+	Reload bool
+}
+
+// HTMLTemplates 从模板文件加载的模板，模板的名称为文件名，eg: templates/index.html 的名称为 index.html
+type HTMLTemplates struct {
+	opts HTMLOptions
+	// fsys 为 nil 时从磁盘加载
+	fsys     fs.FS
+	patterns []string
+	files    []string
+
+	mu       sync.RWMutex
+	modTimes map[string]time.Time
+	shared   *template.Template
+	// pages 页面名称 -> 页面的模板集合，只有设置了 Layout 时才有
+	pages map[string]*template.Template
+}
+
+var _ HTMLRender = (*HTMLTemplates)(nil)
+
+// LoadHTMLGlob 加载磁盘上 pattern 匹配的模板文件，pattern 同 filepath.Glob
+func LoadHTMLGlob(pattern string, opts HTMLOptions) (*HTMLTemplates, error) {
+	return loadHTML(&HTMLTemplates{opts: opts, patterns: []string{pattern}})
+}
+
+// LoadHTMLFiles 加载磁盘上的模板文件
+func LoadHTMLFiles(opts HTMLOptions, files ...string) (*HTMLTemplates, error) {
+	return loadHTML(&HTMLTemplates{opts: opts, files: files})
+}
+
+// LoadHTMLFS 加载 fsys 中 patterns 匹配的模板文件，pattern 同 fs.Glob，eg: embed.FS。
+// fsys 中的文件没有修改时间时(eg: embed.FS)，不会重新解析
+func LoadHTMLFS(fsys fs.FS, opts HTMLOptions, patterns ...string) (*HTMLTemplates, error) {
+	return loadHTML(&HTMLTemplates{opts: opts, fsys: fsys, patterns: patterns})
+}
+
+func loadHTML(h *HTMLTemplates) (*HTMLTemplates, error) {
+	if err := h.reload(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *HTMLTemplates) Instance(name string, data interface{}) Render {
+	if h.opts.Reload {
+		if err := h.reload(); err != nil {
+			return &htmlInstance{err: err}
+		}
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if page, ok := h.pages[name]; ok {
+		return &htmlInstance{template: page, name: h.opts.Layout, data: data}
+	}
+	return &htmlInstance{template: h.shared, name: name, data: data}
+}
+
+// reload 模板文件新增、删除或者修改后重新解析，解析失败时保留之前的模板
+func (h *HTMLTemplates) reload() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	files, err := h.listFiles()
+	if err != nil {
+		return err
+	}
+	modTimes := make(map[string]time.Time, len(files))
+	modified := len(files) != len(h.modTimes)
+	for _, file := range files {
+		info, err := h.stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+		if last, ok := h.modTimes[file]; !ok || !last.Equal(info.ModTime()) {
+			modified = true
+		}
+	}
+	if !modified {
+		return nil
+	}
+
+	if err = h.parse(files); err != nil {
+		return err
+	}
+	h.modTimes = modTimes
+	return nil
+}
+
+// listFiles 获取所有的模板文件
+func (h *HTMLTemplates) listFiles() ([]string, error) {
+	files := append([]string(nil), h.files...)
+	for _, pattern := range h.patterns {
+		var matches []string
+		var err error
+		if h.fsys == nil {
+			matches, err = filepath.Glob(pattern)
+		} else {
+			matches, err = fs.Glob(h.fsys, pattern)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("html: pattern matches no files: %#q", pattern)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, errors.New("html: no files named")
+	}
+	return files, nil
+}
+
+func (h *HTMLTemplates) stat(file string) (fs.FileInfo, error) {
+	if h.fsys == nil {
+		return os.Stat(file)
+	}
+	return fs.Stat(h.fsys, file)
+}
+
+func (h *HTMLTemplates) readFile(file string) ([]byte, error) {
+	if h.fsys == nil {
+		return os.ReadFile(file)
+	}
+	return fs.ReadFile(h.fsys, file)
+}
+
+// parse 解析模板文件，Layout 以及 Partials 解析到 shared 中，每个页面基于 shared 的副本单独解析
+func (h *HTMLTemplates) parse(files []string) error {
+	contents := make(map[string]string, len(files))
+	var names []string
+	for _, file := range files {
+		content, err := h.readFile(file)
+		if err != nil {
+			return err
+		}
+		name := path.Base(filepath.ToSlash(file))
+		if _, ok := contents[name]; !ok {
+			names = append(names, name)
+		}
+		contents[name] = string(content)
+	}
+
+	shared := template.New("").Funcs(h.opts.FuncMap).Delims(h.opts.LeftDelim, h.opts.RightDelim)
+	if h.opts.Layout == "" {
+		for _, name := range names {
+			if _, err := shared.New(name).Parse(contents[name]); err != nil {
+				return err
+			}
+		}
+		h.shared, h.pages = shared, nil
+		return nil
+	}
+
+	isShared := map[string]bool{h.opts.Layout: true}
+	for _, name := range append([]string{h.opts.Layout}, h.opts.Partials...) {
+		content, ok := contents[name]
+		if !ok {
+			return fmt.Errorf("html: template %q is not loaded", name)
+		}
+		isShared[name] = true
+		if _, err := shared.New(name).Parse(content); err != nil {
+			return err
+		}
+	}
+
+	pages := make(map[string]*template.Template, len(names))
+	for _, name := range names {
+		if isShared[name] {
+			continue
+		}
+		page, err := shared.Clone()
+		if err != nil {
+			return err
+		}
+		if _, err = page.New(name).Parse(contents[name]); err != nil {
+			return err
+		}
+		pages[name] = page
+	}
+	h.shared, h.pages = shared, pages
+	return nil
+}
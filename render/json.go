@@ -1,6 +1,17 @@
 package render
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
 
 type jsonRender struct {}
 
@@ -11,3 +22,176 @@ func (j *jsonRender) Render(result interface{}) ([]byte, error) {
 func (j *jsonRender) ContentType() string {
 	return "application/json"
 }
+
+
+const jsonContentType = "application/json; charset=utf-8"
+
+// indentedJSONRender 格式化后的 json，便于阅读
+type indentedJSONRender struct{}
+
+func (r *indentedJSONRender) Render(result interface{}) ([]byte, error) {
+	return json.MarshalIndent(result, "", "    ")
+}
+
+func (r *indentedJSONRender) ContentType() string {
+	return jsonContentType
+}
+
+// pureJSONRender 不转义 html 字符的 json，json.Marshal 会将 <、>、& 转义为 \u003c 等
+type pureJSONRender struct{}
+
+func (r *pureJSONRender) Render(result interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(result); err != nil {
+		return nil, err
+	}
+	// 与 json.Marshal 保持一致，去掉 Encode 追加的换行符
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func (r *pureJSONRender) ContentType() string {
+	return jsonContentType
+}
+
+// asciiJSONRender 将非 ascii 字符转义为 \uXXXX 的 json
+type asciiJSONRender struct{}
+
+func (r *asciiJSONRender) Render(result interface{}) ([]byte, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	for len(data) > 0 {
+		char, size := utf8.DecodeRune(data)
+		data = data[size:]
+		if char < utf8.RuneSelf {
+			buf.WriteByte(byte(char))
+			continue
+		}
+		// 超出 BMP 的字符需要转义为 utf16 代理对
+		r1, r2 := utf16.EncodeRune(char)
+		if r1 == unicode.ReplacementChar {
+			fmt.Fprintf(buf, "\\u%04x", char)
+		} else {
+			fmt.Fprintf(buf, "\\u%04x\\u%04x", r1, r2)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *asciiJSONRender) ContentType() string {
+	return jsonContentType
+}
+
+// jsonpCallbackRegexp 合法的 jsonp 回调函数名，eg: callback、jQuery.cb，避免 xss
+var jsonpCallbackRegexp = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*(\.[a-zA-Z_$][a-zA-Z0-9_$]*)*$`)
+
+// ErrInvalidJSONPCallback jsonp 回调函数名不合法
+var ErrInvalidJSONPCallback = errors.New("invalid jsonp callback")
+
+// jsonpRender callback(json);
+type jsonpRender struct {
+	callback string
+}
+
+// JSONP 返回使用 callback 包装 json 的 Marshaler，callback 只能由字母、数字、'_'、'$' 以及 '.' 组成
+func JSONP(callback string) Marshaler {
+	return &jsonpRender{callback: callback}
+}
+
+func (r *jsonpRender) Render(result interface{}) ([]byte, error) {
+	if !jsonpCallbackRegexp.MatchString(r.callback) {
+		return nil, ErrInvalidJSONPCallback
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBufferString(r.callback)
+	buf.WriteByte('(')
+	buf.Write(data)
+	buf.WriteString(");")
+	return buf.Bytes(), nil
+}
+
+func (r *jsonpRender) ContentType() string {
+	return "application/javascript; charset=utf-8"
+}
+
+// DefaultSecureJSONPrefix SecureJSON 默认的前缀
+const DefaultSecureJSONPrefix = "while(1);"
+
+// secureJSONRender 在 json 前添加前缀，防止 json 劫持
+type secureJSONRender struct {
+	prefix string
+}
+
+// SecureJSON 返回在 json 前添加 prefix 的 Marshaler，eg: while(1);["a","b"]
+func SecureJSON(prefix string) Marshaler {
+	return &secureJSONRender{prefix: prefix}
+}
+
+func (r *secureJSONRender) Render(result interface{}) ([]byte, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(r.prefix), data...), nil
+}
+
+func (r *secureJSONRender) ContentType() string {
+	return jsonContentType
+}
+
+// jsonStreamRender 逐个序列化并写入 next 返回的元素，输出 json 数组
+type jsonStreamRender struct {
+	next func() (interface{}, error)
+}
+
+// JSONStream 返回流式输出 json 数组的 Render，next 依次返回数组的元素，没有更多元素时返回 io.EOF。
+// 每次只序列化并写入一个元素，不会缓存整个响应，适用于导出大量数据，eg: 逐行读取数据库。
+// 获取或者序列化第一个元素失败时，还未写入任何数据
+func JSONStream(next func() (interface{}, error)) Render {
+	return &jsonStreamRender{next: next}
+}
+
+func (r *jsonStreamRender) Render(w http.ResponseWriter) error {
+	sep := "["
+	for {
+		item, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(w, sep); err != nil {
+			return err
+		}
+		if _, err = w.Write(data); err != nil {
+			return err
+		}
+		sep = ","
+	}
+
+	// 没有元素时输出 []
+	if sep == "[" {
+		_, err := io.WriteString(w, "[]")
+		return err
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+func (r *jsonStreamRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", jsonContentType)
+}
@@ -1,11 +1,66 @@
 package render
 
+import (
+	"io"
+	"net/http"
+)
+
+// Render 将响应体直接写入 w，实现时可以边生成边写入，不必缓存整个响应，eg: 逐行写入导出的 csv。
+// 写入第一个字节之前返回的错误，Context.Render 会以 500 响应。
+// HTMLRender 创建的 Render、JSONStream 以及预定义的 XML、YAML 边序列化边写入；
+// 预定义的 json 系列由 encoding/json 序列化完成后一次写入，输出大量 json 时使用 JSONStream
 type Render interface {
+	// Render 写入响应体
+	Render(w http.ResponseWriter) error
+	// WriteContentType 设置响应的 content-type
+	WriteContentType(w http.ResponseWriter)
+}
+
+// Marshaler 将 result 序列化为 []byte，通过 Marshal 转换为 Render
+type Marshaler interface {
 	Render(result interface{}) ([]byte, error)
 	ContentType() string
 }
 
+// encoder 可以将 result 直接写入 w 的 Marshaler，Marshal 优先使用 Encode
+type encoder interface {
+	Encode(w io.Writer, result interface{}) error
+}
 
 var (
-	JSON Render = (*jsonRender)(nil)
-)
\ No newline at end of file
+	JSON         Marshaler = (*jsonRender)(nil)
+	IndentedJSON Marshaler = (*indentedJSONRender)(nil)
+	PureJSON     Marshaler = (*pureJSONRender)(nil)
+	AsciiJSON    Marshaler = (*asciiJSONRender)(nil)
+	XML          Marshaler = (*xmlRender)(nil)
+	YAML         Marshaler = (*yamlRender)(nil)
+	String       Marshaler = (*stringRender)(nil)
+)
+
+// marshalRender 使用 marshaler 渲染 result
+type marshalRender struct {
+	marshaler Marshaler
+	result    interface{}
+}
+
+// Marshal 返回使用 m 渲染 result 的 Render，eg: Marshal(JSON, result)
+func Marshal(m Marshaler, result interface{}) Render {
+	return &marshalRender{marshaler: m, result: result}
+}
+
+func (r *marshalRender) Render(w http.ResponseWriter) error {
+	if e, ok := r.marshaler.(encoder); ok {
+		return e.Encode(w, r.result)
+	}
+
+	data, err := r.marshaler.Render(r.result)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (r *marshalRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", r.marshaler.ContentType())
+}
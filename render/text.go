@@ -0,0 +1,45 @@
+package render
+
+import "fmt"
+
+// stringRender 纯文本，result 可以是 string、[]byte 或者实现了 fmt.Stringer 的类型
+type stringRender struct{}
+
+func (r *stringRender) Render(result interface{}) ([]byte, error) {
+	switch value := result.(type) {
+	case string:
+		return []byte(value), nil
+	case []byte:
+		return value, nil
+	case fmt.Stringer:
+		return []byte(value.String()), nil
+	default:
+		return nil, fmt.Errorf("string render does not support type %T", result)
+	}
+}
+
+func (r *stringRender) ContentType() string {
+	return "text/plain; charset=utf-8"
+}
+
+// dataRender 原始数据，result 必须是 []byte
+type dataRender struct {
+	contentType string
+}
+
+// Data 返回直接输出 []byte 的 Marshaler，响应的 content-type 为 contentType
+func Data(contentType string) Marshaler {
+	return &dataRender{contentType: contentType}
+}
+
+func (r *dataRender) Render(result interface{}) ([]byte, error) {
+	data, ok := result.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("data render does not support type %T", result)
+	}
+	return data, nil
+}
+
+func (r *dataRender) ContentType() string {
+	return r.contentType
+}
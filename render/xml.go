@@ -0,0 +1,20 @@
+package render
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+type xmlRender struct{}
+
+func (r *xmlRender) Render(result interface{}) ([]byte, error) {
+	return xml.Marshal(result)
+}
+
+func (r *xmlRender) Encode(w io.Writer, result interface{}) error {
+	return xml.NewEncoder(w).Encode(result)
+}
+
+func (r *xmlRender) ContentType() string {
+	return "application/xml; charset=utf-8"
+}
@@ -0,0 +1,24 @@
+package render
+
+import (
+	"gopkg.in/yaml.v3"
+	"io"
+)
+
+type yamlRender struct{}
+
+func (r *yamlRender) Render(result interface{}) ([]byte, error) {
+	return yaml.Marshal(result)
+}
+
+func (r *yamlRender) Encode(w io.Writer, result interface{}) error {
+	enc := yaml.NewEncoder(w)
+	if err := enc.Encode(result); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func (r *yamlRender) ContentType() string {
+	return "application/x-yaml; charset=utf-8"
+}
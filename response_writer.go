@@ -0,0 +1,135 @@
+package mini_gin
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter 包装 http.ResponseWriter，记录响应的状态码以及 body 大小，
+// 即使 handler 直接通过 ctx.Writer 写响应，中间件(eg: LoggerMW)同样可以获取真实的状态码以及 body 大小。
+// 客户端是否断开连接通过 ctx.Done() 判断，代替已废弃的 http.CloseNotifier
+type ResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	http.Pusher
+	io.StringWriter
+
+	// Status 响应的状态码，未写入响应头时为 200
+	Status() int
+	// Size 已写入 body 的字节数
+	Size() int
+	// Written 是否已写入响应头
+	Written() bool
+	// Unwrap 获取原始的 http.ResponseWriter
+	Unwrap() http.ResponseWriter
+}
+
+var _ ResponseWriter = (*responseWriter)(nil)
+
+type responseWriter struct {
+	http.ResponseWriter
+	status  int
+	size    int
+	written bool
+}
+
+func (w *responseWriter) reset(writer http.ResponseWriter) {
+	w.ResponseWriter = writer
+	w.status = http.StatusOK
+	w.size = 0
+	w.written = false
+}
+
+// WriteHeader 只有第一次调用生效，同 http.ResponseWriter
+func (w *responseWriter) WriteHeader(status int) {
+	if w.written {
+		return
+	}
+	w.status = status
+	w.written = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
+
+func (w *responseWriter) WriteString(s string) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	n, err := io.WriteString(w.ResponseWriter, s)
+	w.size += n
+	return n, err
+}
+
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+func (w *responseWriter) Written() bool {
+	return w.written
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush 将缓冲的数据发送给客户端，原始的 http.ResponseWriter 不支持时什么也不做
+func (w *responseWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack 接管底层连接，eg: websocket，之后不能再通过 ResponseWriter 写响应
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not implement http.Hijacker")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.written = true
+	}
+	return conn, rw, err
+}
+
+// Push http2 服务端推送，原始的 http.ResponseWriter 不支持时返回 http.ErrNotSupported
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// renderWriter 第一次写入 body 时才写入状态码 status，Context.Render 借此在出错时响应 500
+type renderWriter struct {
+	ResponseWriter
+	status int
+}
+
+func (w *renderWriter) Write(data []byte) (int, error) {
+	w.ResponseWriter.WriteHeader(w.status)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *renderWriter) WriteString(s string) (int, error) {
+	w.ResponseWriter.WriteHeader(w.status)
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *renderWriter) Flush() {
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Flush()
+}
@@ -0,0 +1,135 @@
+//go:build !windows
+// +build !windows
+
+package mini_gin
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// listenFdsEnv 平滑重启时父进程通过该环境变量告诉子进程传递的监听，
+// 值为逗号分隔的监听 key，第 i 个监听对应的 fd 为 3+i
+const listenFdsEnv = "MINI_GIN_LISTEN_FDS"
+
+// restartSignals 收到这些信号时平滑重启
+var restartSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR2}
+
+// restart 启动新的进程并传递所有监听，新进程开始提供服务后通过 SIGTERM 通知当前进程优雅退出
+func (e *Engine) restart() error {
+	files := make([]*os.File, 0, len(e.endpoints))
+	defer func() {
+		// 子进程持有的是 fd 的副本
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}()
+
+	keys := make([]string, 0, len(e.endpoints))
+	for _, ep := range e.endpoints {
+		key, ok := e.listenKeys[ep.ln]
+		if !ok {
+			return fmt.Errorf("listener %s is not created by Engine.Listen", ep.ln.Addr())
+		}
+		filer, ok := ep.ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("listener %s does not support file descriptor", ep.ln.Addr())
+		}
+		file, err := filer.File()
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+		keys = append(keys, url.QueryEscape(key))
+	}
+
+	path, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Env = append(environWithout(listenFdsEnv), listenFdsEnv+"="+strings.Join(keys, ","))
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	log.Infof("Start child process %d", cmd.Process.Pid)
+
+	// socket 文件交由子进程清理
+	for _, ep := range e.endpoints {
+		if ep.unixFile == "" {
+			continue
+		}
+		if ln, ok := ep.ln.(*net.UnixListener); ok {
+			ln.SetUnlinkOnClose(false)
+		}
+		ep.unixFile = ""
+	}
+
+	go func() {
+		err := cmd.Wait()
+		log.Infof("Child process %d exit, error: %v", cmd.Process.Pid, err)
+	}()
+	return nil
+}
+
+// inheritListeners 解析父进程传递的监听，当前进程不是由平滑重启创建时返回 nil
+func inheritListeners() (map[string]net.Listener, error) {
+	value, ok := os.LookupEnv(listenFdsEnv)
+	if !ok {
+		return nil, nil
+	}
+	// 避免传递给当前进程创建的其他子进程
+	_ = os.Unsetenv(listenFdsEnv)
+
+	listeners := make(map[string]net.Listener)
+	if value == "" {
+		return listeners, nil
+	}
+	for i, escaped := range strings.Split(value, ",") {
+		key, err := url.QueryUnescape(escaped)
+		if err != nil {
+			return listeners, err
+		}
+		file := os.NewFile(uintptr(3+i), key)
+		ln, err := net.FileListener(file)
+		_ = file.Close()
+		if err != nil {
+			return listeners, err
+		}
+		listeners[key] = ln
+	}
+	return listeners, nil
+}
+
+// takeOverFromParent 当前进程由平滑重启创建时，关闭未使用的监听并通知父进程优雅退出
+func (e *Engine) takeOverFromParent() {
+	if !e.loadInheritedListeners() {
+		return
+	}
+	for key, ln := range e.inherited {
+		_ = ln.Close()
+		delete(e.inherited, key)
+	}
+	if err := syscall.Kill(os.Getppid(), syscall.SIGTERM); err != nil {
+		log.Errorf("Notify parent process error: %v", err)
+	}
+}
+
+func environWithout(key string) []string {
+	env := os.Environ()
+	result := make([]string, 0, len(env))
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, key+"=") {
+			result = append(result, kv)
+		}
+	}
+	return result
+}
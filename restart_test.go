@@ -0,0 +1,85 @@
+//go:build !windows
+// +build !windows
+
+package mini_gin
+
+import (
+	"context"
+	"github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestEngine_GracefulRestart(t *testing.T) {
+	// 子进程：使用父进程传递的监听提供服务，收到 /stop 请求后退出
+	if _, ok := os.LookupEnv(listenFdsEnv); ok {
+		app := NewWithCfg(WithGracefulRestart())
+		app.GET("/ping", func(ctx *Context) {
+			_, _ = ctx.Write([]byte("child"))
+		})
+		app.GET("/stop", func(ctx *Context) {
+			go func() { _ = app.Shutdown(context.Background()) }()
+		})
+		if err := app.Run(); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	convey.Convey("", t, func() {
+		// 子进程通过环境变量获取相同的监听地址，并且只执行当前测试
+		ln, _ := net.Listen("tcp", "127.0.0.1:0")
+		addr := ln.Addr().String()
+		_ = ln.Close()
+		_ = os.Setenv("MINI_GIN_SERVER_ADDR", addr)
+		defer os.Unsetenv("MINI_GIN_SERVER_ADDR")
+		args := os.Args
+		os.Args = []string{args[0], "-test.run=^TestEngine_GracefulRestart$"}
+		defer func() { os.Args = args }()
+
+		app := NewWithCfg(WithGracefulRestart())
+		app.GET("/ping", func(ctx *Context) {
+			_, _ = ctx.Write([]byte("parent"))
+		})
+		ready := make(chan struct{})
+		app.OnStart(func(ctx context.Context) error {
+			close(ready)
+			return nil
+		})
+
+		get := func(route string) string {
+			resp, err := http.Get("http://" + addr + route)
+			if err != nil {
+				return err.Error()
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			return string(body)
+		}
+
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- app.Run()
+		}()
+		<-ready
+		convey.So(get("/ping"), convey.ShouldEqual, "parent")
+
+		// 子进程开始提供服务后父进程优雅退出
+		convey.So(syscall.Kill(os.Getpid(), syscall.SIGHUP), convey.ShouldBeNil)
+		select {
+		case err := <-errCh:
+			convey.So(err, convey.ShouldBeNil)
+		case <-time.After(10 * time.Second):
+			t.Fatal("parent process does not exit after restart")
+		}
+
+		http.DefaultClient.CloseIdleConnections()
+		convey.So(get("/ping"), convey.ShouldEqual, "child")
+		get("/stop")
+	})
+}
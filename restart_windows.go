@@ -0,0 +1,20 @@
+package mini_gin
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// windows 不支持平滑重启
+var restartSignals []os.Signal
+
+func (e *Engine) restart() error {
+	return errors.New("graceful restart is not supported on windows")
+}
+
+func inheritListeners() (map[string]net.Listener, error) {
+	return nil, nil
+}
+
+func (e *Engine) takeOverFromParent() {}
@@ -1,7 +1,7 @@
 package mini_gin
 
 import (
-	"fmt"
+	"github.com/WANGgbin/mini_gin/util"
 	"net/http"
 	"path"
 	"strings"
@@ -10,73 +10,195 @@ import (
 // RouteGroup 表示一个路由组
 type RouteGroup struct {
 	engine *Engine
-
-	basePrefix   string
+	// parent 父路由组，根路由组为 nil
+	parent *RouteGroup
+	// host 路由组所属的 host 模式，为 nil 表示默认路由
+	host *hostRoutes
+	// trees 路由注册到的路由树
+	trees methodTrees
+
+	basePrefix string
+	// baseHandlers 当前路由组自身的中间件，不包括父路由组的中间件
 	baseHandlers []MiddleWare
 }
 
 func newRouteGroup(engine *Engine, basePrefix string, baseHandlers ...MiddleWare) *RouteGroup {
+	return engine.rootRouteGroup.Group(basePrefix, baseHandlers...)
+}
+
+// Group 基于当前路由组创建子路由组，子路由组继承当前路由组的路由前缀以及中间件。
+// 中间件在 Engine.Freeze 时才会编译到路由中，所以之后通过 Use 给当前路由组添加的中间件对子路由组同样有效
+// eg: api.Group("/v1", AuthMW).Group("/admin", AdminMW)
+func (rg *RouteGroup) Group(prefix string, handlers ...MiddleWare) *RouteGroup {
 	return &RouteGroup{
-		engine:       engine,
-		basePrefix:   engine.rootRouteGroup.getAbsRoute(basePrefix),
-		baseHandlers: engine.rootRouteGroup.getHandlers(baseHandlers...),
+		engine:       rg.engine,
+		parent:       rg,
+		host:         rg.host,
+		trees:        rg.trees,
+		basePrefix:   rg.getAbsRoute(prefix),
+		baseHandlers: handlers,
 	}
 }
 
 func (rg *RouteGroup) Append(mws ...MiddleWare) {
+	rg.engine.assertNotFrozen()
 	rg.baseHandlers = append(rg.baseHandlers, mws...)
 }
 
-func (rg *RouteGroup) GET(route string, handler MiddleWare) {
-	rg.register(http.MethodGet, route, handler)
+// Use 给路由组添加中间件，同 Engine.Use
+func (rg *RouteGroup) Use(mws ...MiddleWare) {
+	rg.Append(mws...)
+}
+
+func (rg *RouteGroup) GET(route string, handler MiddleWare) *Route {
+	return rg.register(http.MethodGet, route, handler)
+}
+
+func (rg *RouteGroup) POST(route string, handler MiddleWare) *Route {
+	return rg.register(http.MethodPost, route, handler)
+}
+
+func (rg *RouteGroup) PUT(route string, handler MiddleWare) *Route {
+	return rg.register(http.MethodPut, route, handler)
+}
+
+func (rg *RouteGroup) DELETE(route string, handler MiddleWare) *Route {
+	return rg.register(http.MethodDelete, route, handler)
+}
+
+func (rg *RouteGroup) PATCH(route string, handler MiddleWare) *Route {
+	return rg.register(http.MethodPatch, route, handler)
+}
+
+func (rg *RouteGroup) HEAD(route string, handler MiddleWare) *Route {
+	return rg.register(http.MethodHead, route, handler)
+}
+
+func (rg *RouteGroup) OPTIONS(route string, handler MiddleWare) *Route {
+	return rg.register(http.MethodOptions, route, handler)
+}
+
+func (rg *RouteGroup) CONNECT(route string, handler MiddleWare) *Route {
+	return rg.register(http.MethodConnect, route, handler)
+}
+
+func (rg *RouteGroup) TRACE(route string, handler MiddleWare) *Route {
+	return rg.register(http.MethodTrace, route, handler)
 }
 
-func (rg *RouteGroup) POST(route string, handler MiddleWare) {
-	rg.register(http.MethodPost, route, handler)
+// Handle 注册任意方法的路由，非标准方法(eg: WebDAV 的 PROPFIND)对应的路由树会在首次注册时创建
+func (rg *RouteGroup) Handle(method, route string, handlers ...MiddleWare) *Route {
+	util.Assert(validateMethod(method), "http method %s is not valid", method)
+	return rg.register(method, route, handlers...)
 }
 
-func (rg *RouteGroup) PUT(route string, handler MiddleWare) {
-	rg.register(http.MethodPut, route, handler)
+// Any 在所有标准方法上注册路由，返回的 *Route 可用于给该路由命名
+func (rg *RouteGroup) Any(route string, handlers ...MiddleWare) *Route {
+	var r *Route
+	for _, method := range anyMethods {
+		r = rg.register(method, route, handlers...)
+	}
+	return r
 }
 
-func (rg *RouteGroup) DELETE(route string, handler MiddleWare) {
-	rg.register(http.MethodDelete, route, handler)
+// mountPathParam Mount 注册的路由中 catch-all 参数的名称
+const mountPathParam = "mountpath"
+
+// Mount 将 http.Handler 挂载到 prefix 下，prefix 以及 prefix 下的所有路径的标准方法都交给 h 处理，
+// h 收到的请求路径去掉了 prefix，eg: Mount("/legacy", mux) 后，请求 /legacy/users 对应 mux 中的 /users
+func (rg *RouteGroup) Mount(prefix string, h http.Handler) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	handler := mountHandler(h)
+	// 挂载到根路径时，catch-all 路由可以匹配根路径
+	if rg.getAbsRoute(prefix) != "/" {
+		rg.Any(prefix, handler)
+	}
+	rg.Any(prefix+"/*"+mountPathParam, handler)
 }
 
-func (rg *RouteGroup) register(method, route string, handler MiddleWare) {
-	tree := rg.engine.method2routes[method]
-	if tree == nil {
-		panic(fmt.Sprintf("route tree of method %s is nil", method))
+// mountHandler 去掉请求路径中挂载的前缀后交给 h 处理
+func mountHandler(h http.Handler) MiddleWare {
+	return func(ctx *Context) {
+		u := *ctx.req.URL
+		u.Path = "/" + ctx.Param(mountPathParam)
+		u.RawPath = ""
+		req := *ctx.req
+		req.URL = &u
+		h.ServeHTTP(ctx.Writer, &req)
 	}
+}
 
-	tree.insert(rg.getAbsRoute(route), rg.getHandlers(handler)...)
+// register 注册路由，此时路由树中只记录路由自身的 handlers，路由组的中间件在 Engine.Freeze 时编译
+func (rg *RouteGroup) register(method, route string, handlers ...MiddleWare) *Route {
+	rg.engine.assertNotFrozen()
+	tree := rg.trees.getOrCreate(method)
+	absRoute := rg.getAbsRoute(route)
+	r := &Route{engine: rg.engine, group: rg, method: method, path: absRoute, handlers: handlers}
+	tree.insertRoute(absRoute, handlers, r)
+	numOfParams := len(parseDynKeys(absRoute))
+	if rg.host != nil {
+		numOfParams += rg.host.numOfParams()
+	}
+	if numOfParams > rg.engine.maxParams {
+		rg.engine.maxParams = numOfParams
+	}
+	return r
 }
 
+// getAbsRoute 获取绝对路由，保留 relativeRoute 末尾的 '/'，/users 与 /users/ 是两条不同的路由。
+// relativeRoute 为 "/" 时表示路由组自身，eg: Group("/api").GET("/", h) 注册的是 /api
 func (rg *RouteGroup) getAbsRoute(relativeRoute string) string {
-	return path.Join(rg.basePrefix, relativeRoute)
+	absRoute := path.Join(rg.basePrefix, relativeRoute)
+	if relativeRoute != "/" && strings.HasSuffix(relativeRoute, "/") && !strings.HasSuffix(absRoute, "/") {
+		absRoute += "/"
+	}
+	return absRoute
 }
 
 func (rg *RouteGroup) getBaseHandlers() []MiddleWare {
-	return rg.baseHandlers
+	return rg.getHandlers()
 }
 
+// getHandlers 根据当前的路由组层级获取完整的 handlers：根路由组中间件 -> ... -> 当前路由组中间件 -> deltas
 func (rg *RouteGroup) getHandlers(deltas ...MiddleWare) []MiddleWare {
-	length := len(rg.baseHandlers) + len(deltas)
+	length := len(deltas)
+	for group := rg; group != nil; group = group.parent {
+		length += len(group.baseHandlers)
+	}
 	if length == 0 {
 		return nil
 	}
 
 	handlers := make([]MiddleWare, length)
-	copy(handlers, rg.baseHandlers)
-	copy(handlers[len(rg.baseHandlers):], deltas)
+	index := length - len(deltas)
+	copy(handlers[index:], deltas)
+	for group := rg; group != nil; group = group.parent {
+		index -= len(group.baseHandlers)
+		copy(handlers[index:], group.baseHandlers)
+	}
 
 	return handlers
 }
 
+// validateMethod 校验 method 是否合法，method 只能由大写字母组成
+func validateMethod(method string) bool {
+	if method == "" {
+		return false
+	}
+
+	for idx := 0; idx < len(method); idx++ {
+		if method[idx] < 'A' || method[idx] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
 // validateRoute 校验 route 是否合法
 // 1. 必须以 '/' 开始
 // 2. 如果包含动态参数，必须是 /[anything]:key[/] 格式
 // 3. 两个 '/' 之间不能为空
+// 4. catch-all 通配符必须位于最后一个 segment: /[anything]*key
 func validateRoute(route string) bool {
 	if route == "" || route[0] != '/' {
 		return false
@@ -84,10 +206,13 @@ func validateRoute(route string) bool {
 
 	route = strings.TrimSuffix(route[1:], "/")
 	segs := strings.Split(route, "/")
-	for _, seg := range segs {
+	for idx, seg := range segs {
 		if !validateSegment(seg) {
 			return false
 		}
+		if strings.Contains(seg, "*") && idx != len(segs)-1 {
+			return false
+		}
 	}
 	return true
 }
@@ -96,13 +221,18 @@ func validateRoute(route string) bool {
 // segment: xxx
 // 1. 不能为空
 // 2. 至多只能有一个 wildcard 且 wildcard 对应的 key 不能为空
+// 3. wildcard 的约束 '<>' 不参与校验
 func validateSegment(seg string) bool {
 	if seg == "" {
 		return false
 	}
 
-	firstIndex := strings.Index(seg, ":")
-	if firstIndex != strings.LastIndex(seg, ":") {
+	if index := strings.IndexByte(seg, '<'); index != -1 && seg[len(seg)-1] == '>' {
+		seg = seg[:index]
+	}
+
+	firstIndex := strings.IndexAny(seg, ":*")
+	if firstIndex != strings.LastIndexAny(seg, ":*") {
 		return false
 	}
 
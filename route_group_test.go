@@ -2,6 +2,8 @@ package mini_gin
 
 import (
 	"github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -47,6 +49,14 @@ func Test_validateRoute(t *testing.T) {
 				route: "/prefix:key",
 				wantResult: true,
 			},
+			{
+				route: "/static/*filepath",
+				wantResult: true,
+			},
+			{
+				route: "/static/*filepath/a",
+				wantResult: false,
+			},
 		}
 
 		for _, testCase := range testCases {
@@ -89,6 +99,18 @@ func Test_validateSegment(t *testing.T) {
 				seg: ":key1:key2",
 				valid: false,
 			},
+			{
+				seg: "*filepath",
+				valid: true,
+			},
+			{
+				seg: "*",
+				valid: false,
+			},
+			{
+				seg: ":key*filepath",
+				valid: false,
+			},
 		}
 
 		for _, testCase := range testCases {
@@ -98,4 +120,102 @@ func Test_validateSegment(t *testing.T) {
 			})
 		}
 	})
-}
\ No newline at end of file
+}
+func TestRouteGroup_Group(t *testing.T) {
+	convey.Convey("", t, func() {
+		app := New()
+		var trace []string
+		mw := func(name string) MiddleWare {
+			return func(ctx *Context) {
+				trace = append(trace, name)
+			}
+		}
+
+		app.Use(mw("root"))
+		api := app.NewGroup("/api", mw("api"))
+		v1 := api.Group("/v1")
+		admin := v1.Group("/admin", mw("auth"))
+		admin.Use(mw("admin"))
+		admin.GET("/users", mw("handler"))
+
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/users", nil))
+		convey.So(trace, convey.ShouldResemble, []string{"root", "api", "auth", "admin", "handler"})
+	})
+}
+
+func TestRouteGroup_getAbsRoute(t *testing.T) {
+	convey.Convey("", t, func() {
+		testCases := []struct {
+			prefix string
+			route  string
+			want   string
+		}{
+			{prefix: "/", route: "/", want: "/"},
+			{prefix: "/api", route: "/", want: "/api"},
+			{prefix: "/api", route: "", want: "/api"},
+			{prefix: "/api", route: "/users", want: "/api/users"},
+			{prefix: "/api", route: "/users/", want: "/api/users/"},
+		}
+
+		app := New()
+		for _, testCase := range testCases {
+			convey.So(app.NewGroup(testCase.prefix).getAbsRoute(testCase.route), convey.ShouldEqual, testCase.want)
+		}
+
+		// Group("/api").GET("/", h) 注册的是 /api
+		app.NewGroup("/api").GET("/", func(ctx *Context) {})
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api", nil))
+		convey.So(w.Code, convey.ShouldEqual, http.StatusOK)
+	})
+}
+
+func TestRouteGroup_LateBoundMiddleware(t *testing.T) {
+	convey.Convey("", t, func() {
+		app := New()
+		var trace []string
+		mw := func(name string) MiddleWare {
+			return func(ctx *Context) {
+				trace = append(trace, name)
+			}
+		}
+
+		api := app.NewGroup("/api")
+		v1 := api.Group("/v1")
+		v1.GET("/users", mw("handler"))
+		app.Host("api.example.com").GET("/users", mw("host"))
+		// 中间件晚于路由注册，同样生效
+		app.Use(mw("root"))
+		api.Use(mw("api"))
+		app.NoRoute(mw("noRoute"))
+
+		convey.Convey("route", func() {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/users", nil))
+			convey.So(trace, convey.ShouldResemble, []string{"root", "api", "handler"})
+		})
+
+		convey.Convey("host", func() {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Host = "api.example.com"
+			app.ServeHTTP(w, req)
+			convey.So(trace, convey.ShouldResemble, []string{"root", "host"})
+		})
+
+		convey.Convey("no route", func() {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/not/exist", nil))
+			convey.So(w.Code, convey.ShouldEqual, http.StatusNotFound)
+			convey.So(trace, convey.ShouldResemble, []string{"root", "noRoute"})
+		})
+
+		convey.Convey("frozen", func() {
+			app.Freeze()
+			convey.So(func() { app.Use(mw("late")) }, convey.ShouldPanic)
+			convey.So(func() { v1.GET("/late", mw("late")) }, convey.ShouldPanic)
+			convey.So(func() { app.NoMethod(mw("late")) }, convey.ShouldPanic)
+		})
+	})
+}
@@ -0,0 +1,151 @@
+package mini_gin
+
+import (
+	"fmt"
+	"github.com/WANGgbin/mini_gin/util"
+	log "github.com/sirupsen/logrus"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// RouteInfo 描述一条已注册的路由
+type RouteInfo struct {
+	// Host 路由所属的 host 模式，为空表示默认路由
+	Host   string
+	Method string
+	Path   string
+	// Handler 路由处理函数的函数名
+	Handler string
+	// MiddleWares 处理函数之前的中间件数量
+	MiddleWares int
+}
+
+// Routes 获取所有已注册的路由，默认路由在前，host 路由按照 host 模式的注册顺序在后，
+// 每组路由按照 method 排序，同一 method 下按照路由树的遍历顺序
+func (e *Engine) Routes() []RouteInfo {
+	routes := getRoutes("", e.method2routes, nil)
+	for _, host := range e.hosts {
+		routes = getRoutes(host.pattern, host.trees, routes)
+	}
+	return routes
+}
+
+func getRoutes(host string, trees methodTrees, routes []RouteInfo) []RouteInfo {
+	methods := make([]string, 0, len(trees))
+	for method := range trees {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	for _, method := range methods {
+		trees[method].walk(func(route string, n *node) {
+			handlers := n.route.getHandlers()
+			routes = append(routes, RouteInfo{
+				Host:        host,
+				Method:      method,
+				Path:        route,
+				Handler:     util.NameOfFunction(handlers[len(handlers)-1]),
+				MiddleWares: len(handlers) - 1,
+			})
+		})
+	}
+	return routes
+}
+
+// debugPrintRoutes debug 模式下打印所有已注册的路由
+func (e *Engine) debugPrintRoutes() {
+	if !e.Debug {
+		return
+	}
+
+	for _, route := range e.Routes() {
+		log.Infof("[DEBUG] %-7s %-30s --> %s (%d middlewares)", route.Method, route.Host+route.Path, route.Handler, route.MiddleWares)
+	}
+}
+
+// Route 表示一条注册成功的路由，可以给路由命名，然后通过 Engine.URL 根据路由名生成 url
+type Route struct {
+	engine *Engine
+	// group 路由所属的路由组
+	group  *RouteGroup
+	method string
+	path   string
+	// handlers 路由自身的 handlers，不包括路由组的中间件
+	handlers []MiddleWare
+}
+
+// getHandlers 根据路由组层级获取完整的 handlers
+func (r *Route) getHandlers() []MiddleWare {
+	return r.group.getHandlers(r.handlers...)
+}
+
+// Name 给路由命名，路由名必须全局唯一
+// eg: rg.GET("/users/:id", handler).Name("user.show")
+func (r *Route) Name(name string) *Route {
+	util.Assert(name != "", "route name should not be empty")
+	if existing, ok := r.engine.namedRoutes[name]; ok {
+		panic(fmt.Sprintf("route name %s of path: %s has been used by path: %s", name, r.path, existing.path))
+	}
+
+	r.engine.namedRoutes[name] = r
+	return r
+}
+
+// URL 根据路由名以及动态参数生成 url，params 为 key, value 交替的参数列表，必须提供路由中所有的动态参数。
+// 对于 host 路由组中的路由，只生成 path 部分
+// eg: engine.URL("user.show", "id", "42") => /users/42
+func (e *Engine) URL(name string, params ...string) (string, error) {
+	r, ok := e.namedRoutes[name]
+	if !ok {
+		return "", fmt.Errorf("route named %s not found", name)
+	}
+
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("params of route %s should be key, value pairs, but got %d params", name, len(params))
+	}
+
+	key2value := make(map[string]string, len(params)/2)
+	for idx := 0; idx < len(params); idx += 2 {
+		key2value[params[idx]] = params[idx+1]
+	}
+
+	// 复用节点解析动态参数的逻辑
+	n := newNode(r.path, nil, r.path)
+	var builder strings.Builder
+	curIndex := 0
+	for idx, dynKey := range n.dynKeys {
+		builder.WriteString(r.path[curIndex:dynKey[0]])
+		key := n.getDynKeyName(idx)
+		value, ok := key2value[key]
+		if !ok {
+			return "", fmt.Errorf("param %s of route %s: %s is missing", key, name, r.path)
+		}
+		if !n.matchConstraint(idx, value) {
+			return "", fmt.Errorf("param %s of route %s: %s does not match constraint, value: %s", key, name, r.path, value)
+		}
+		delete(key2value, key)
+
+		if isCatchAll(r.path[dynKey[0]]) {
+			builder.WriteString(escapeCatchAll(value))
+		} else {
+			builder.WriteString(url.PathEscape(value))
+		}
+		curIndex = dynKey[1] + 1
+	}
+	builder.WriteString(r.path[curIndex:])
+
+	for key := range key2value {
+		return "", fmt.Errorf("param %s is not defined in route %s: %s", key, name, r.path)
+	}
+	return builder.String(), nil
+}
+
+// escapeCatchAll catch-all 参数可以包含 '/'，需要逐个 segment 转义
+func escapeCatchAll(value string) string {
+	segs := strings.Split(value, "/")
+	for idx, seg := range segs {
+		segs[idx] = url.PathEscape(seg)
+	}
+	return strings.Join(segs, "/")
+}
@@ -0,0 +1,74 @@
+package mini_gin_test
+
+import (
+	"fmt"
+	"github.com/WANGgbin/mini_gin"
+	"github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func listUsers(ctx *mini_gin.Context) {}
+
+func getUser(ctx *mini_gin.Context) {}
+
+func TestRoutes(t *testing.T) {
+	convey.Convey("", t, func() {
+		app := mini_gin.New()
+		app.Use(mini_gin.RecoverMW)
+		app.GET("/users", listUsers)
+		app.GET("/users/:id", getUser)
+		gp := app.NewGroup("/admin", mini_gin.LoggerMW)
+		gp.POST("/users", listUsers)
+		app.Host("api.example.com").GET("/users", listUsers)
+
+		convey.So(app.Routes(), convey.ShouldResemble, []mini_gin.RouteInfo{
+			{Method: "GET", Path: "/users", Handler: "github.com/WANGgbin/mini_gin_test.listUsers", MiddleWares: 1},
+			{Method: "GET", Path: "/users/:id", Handler: "github.com/WANGgbin/mini_gin_test.getUser", MiddleWares: 1},
+			{Method: "POST", Path: "/admin/users", Handler: "github.com/WANGgbin/mini_gin_test.listUsers", MiddleWares: 2},
+			{Host: "api.example.com", Method: "GET", Path: "/users", Handler: "github.com/WANGgbin/mini_gin_test.listUsers", MiddleWares: 1},
+		})
+	})
+}
+
+func TestURL(t *testing.T) {
+	convey.Convey("", t, func() {
+		app := mini_gin.New()
+		gp := app.NewGroup("/api/v1")
+		gp.GET("/users/:id", getUser).Name("user.show")
+		gp.GET("/users/:id/files/*filepath", getUser).Name("user.file")
+		app.GET("/users", listUsers).Name("user.list")
+		app.GET("/orders/:id<int>", getUser).Name("order.show")
+
+		convey.So(func() { app.GET("/users/:id", getUser).Name("user.list") }, convey.ShouldPanic)
+
+		testCases := []struct {
+			name    string
+			params  []string
+			wantURL string
+			wantErr bool
+		}{
+			{name: "user.list", wantURL: "/users"},
+			{name: "user.show", params: []string{"id", "42"}, wantURL: "/api/v1/users/42"},
+			{name: "user.show", params: []string{"id", "a b/c"}, wantURL: "/api/v1/users/a%20b%2Fc"},
+			{name: "user.file", params: []string{"filepath", "docs/a b.txt", "id", "42"}, wantURL: "/api/v1/users/42/files/docs/a%20b.txt"},
+			{name: "user.show", wantErr: true},
+			{name: "user.show", params: []string{"id"}, wantErr: true},
+			{name: "user.show", params: []string{"id", "42", "name", "tom"}, wantErr: true},
+			{name: "not.exist", wantErr: true},
+			{name: "order.show", params: []string{"id", "42"}, wantURL: "/orders/42"},
+			{name: "order.show", params: []string{"id", "abc"}, wantErr: true},
+		}
+
+		for idx, testCase := range testCases {
+			convey.Convey(fmt.Sprintf("%d %s", idx, testCase.name), func() {
+				gotURL, err := app.URL(testCase.name, testCase.params...)
+				if testCase.wantErr {
+					convey.So(err, convey.ShouldNotBeNil)
+				} else {
+					convey.So(err, convey.ShouldBeNil)
+					convey.So(gotURL, convey.ShouldEqual, testCase.wantURL)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,406 @@
+package mini_gin
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// shutdownSignals 收到这些信号时优雅退出，期间再次收到信号则强制退出
+var shutdownSignals = []os.Signal{syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM}
+
+// Hook 服务生命周期的钩子函数
+type Hook func(ctx context.Context) error
+
+// OnStart 注册服务启动前执行的钩子，按照注册顺序执行，任一钩子返回错误时服务不会启动
+func (e *Engine) OnStart(hooks ...Hook) {
+	e.onStart = append(e.onStart, hooks...)
+}
+
+// OnShutdown 注册服务关闭时执行的钩子，在进行中的请求处理完毕(或等待超时)之后按照注册顺序执行，
+// eg: 关闭数据库连接池、刷新日志。钩子的 ctx 与 Shutdown 的 ctx 无关，所有钩子共享 shutdownTimeout 的执行时间
+func (e *Engine) OnShutdown(hooks ...Hook) {
+	e.onShutdown = append(e.onShutdown, hooks...)
+}
+
+// endpoint 服务监听的端点，所有端点共享同一个 http.Server，关闭时一起关闭
+type endpoint struct {
+	ln net.Listener
+	// 非空时使用 TLS
+	certFile, keyFile string
+	// unix socket 文件，关闭后清理
+	unixFile string
+}
+
+func (ep *endpoint) isTLS() bool {
+	return ep.certFile != "" || ep.keyFile != ""
+}
+
+// listener 获取实际提供服务的监听，TLS 端点在启动时加载证书，证书错误时 Start 直接返回错误
+func (ep *endpoint) listener(server *http.Server) (net.Listener, error) {
+	if !ep.isTLS() {
+		return ep.ln, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(ep.certFile, ep.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{}
+	if server.TLSConfig != nil {
+		config = server.TLSConfig.Clone()
+	}
+	config.Certificates = append(config.Certificates, cert)
+	if len(config.NextProtos) == 0 {
+		// 同 http.Server.ServeTLS，支持 http2
+		config.NextProtos = []string{"h2", "http/1.1"}
+	}
+	return tls.NewListener(ep.ln, config), nil
+}
+
+// cleanup 关闭监听并清理 unix socket 文件
+func (ep *endpoint) cleanup() {
+	_ = ep.ln.Close()
+	if ep.unixFile != "" {
+		if err := os.Remove(ep.unixFile); err != nil && !os.IsNotExist(err) {
+			log.Errorf("Remove unix socket %s error: %v", ep.unixFile, err)
+		}
+	}
+}
+
+// AddListener 添加额外的监听，Start 以及 Run 系列方法启动服务时会同时在这些监听上提供服务，
+// eg: 对外通过 RunTLS 提供 https 服务，同时对内通过 AddListener 提供 http 服务
+func (e *Engine) AddListener(ln net.Listener) {
+	e.endpoints = append(e.endpoints, &endpoint{ln: ln})
+}
+
+// AddTLSListener 同 AddListener，在 ln 上提供 https 服务
+func (e *Engine) AddTLSListener(ln net.Listener, certFile, keyFile string) {
+	e.endpoints = append(e.endpoints, &endpoint{ln: ln, certFile: certFile, keyFile: keyFile})
+}
+
+// Start 启动服务，不会阻塞。没有通过 AddListener 添加监听时，在 EngineOptions.Addr 上提供 http 服务。
+// 监听失败、证书错误以及 OnStart 钩子返回的错误会直接返回。
+// 之后通过 Shutdown 关闭服务，通过 Wait 等待服务退出。
+func (e *Engine) Start() error {
+	e.lifecycleMu.Lock()
+	if e.started {
+		e.lifecycleMu.Unlock()
+		return errors.New("engine has already been started")
+	}
+	e.started = true
+	// 之前启动失败时 serve 已经结束，重新启动使用新的 serveState，之前的 Wait 仍然返回之前的错误
+	select {
+	case <-e.serve.done:
+		e.serve = newServeState()
+	default:
+	}
+	state := e.serve
+	e.lifecycleMu.Unlock()
+
+	// 用户通过 WithServer 传入的 http.Server 可以自定义 Handler，eg: 在 engine 外层包装 h2c
+	if e.server.Handler == nil {
+		e.server.Handler = e
+	}
+	e.Freeze()
+	e.debugPrintRoutes()
+
+	if len(e.endpoints) == 0 {
+		ln, err := e.Listen("tcp", e.server.Addr)
+		if err != nil {
+			return e.startFailed(state, err)
+		}
+		e.AddListener(ln)
+	}
+
+	lns := make([]net.Listener, 0, len(e.endpoints))
+	for _, ep := range e.endpoints {
+		ln, err := ep.listener(e.server)
+		if err != nil {
+			return e.startFailed(state, err)
+		}
+		lns = append(lns, ln)
+	}
+
+	for _, hook := range e.onStart {
+		if err := hook(context.Background()); err != nil {
+			return e.startFailed(state, err)
+		}
+	}
+
+	// 任一端点退出，关闭所有端点
+	errCh := make(chan error, len(lns))
+	for _, ln := range lns {
+		go func(ln net.Listener) {
+			errCh <- e.server.Serve(ln)
+		}(ln)
+	}
+	e.takeOverFromParent()
+	go func() {
+		err := <-errCh
+		// http.ErrServerClosed 说明调用了 Shutdown，此时 Shutdown 会等待关闭完成并返回关闭时的错误
+		if err == http.ErrServerClosed {
+			err = nil
+		}
+		// 异常退出时同样需要执行关闭钩子，释放资源，最多等待 shutdownTimeout
+		ctx, cancel := e.shutdownContext(context.Background())
+		if shutdownErr := e.Shutdown(ctx); err == nil {
+			err = shutdownErr
+		}
+		cancel()
+		e.cleanupEndpoints()
+		state.finish(err)
+	}()
+	return nil
+}
+
+// startFailed 启动失败时关闭所有端点，之后可以重新调用 Start，Wait 直接返回 err
+func (e *Engine) startFailed(state *serveState, err error) error {
+	e.cleanupEndpoints()
+	e.endpoints = nil
+	e.lifecycleMu.Lock()
+	// 先结束 state 再允许重新启动，保证重新启动时使用新的 serveState
+	state.finish(err)
+	e.started = false
+	e.lifecycleMu.Unlock()
+	return err
+}
+
+// serveState 一次启动的退出状态
+type serveState struct {
+	// 服务退出时关闭，err 为服务异常退出、关闭或者启动失败时的错误
+	done chan struct{}
+	err  error
+}
+
+func newServeState() *serveState {
+	return &serveState{done: make(chan struct{})}
+}
+
+func (s *serveState) finish(err error) {
+	s.err = err
+	close(s.done)
+}
+
+// currentServe 获取当前启动对应的 serveState
+func (e *Engine) currentServe() *serveState {
+	e.lifecycleMu.Lock()
+	defer e.lifecycleMu.Unlock()
+	return e.serve
+}
+
+// Wait 阻塞直到服务退出，返回服务异常退出或者关闭时的错误，启动失败时直接返回启动时的错误。
+// 可以与 Start 并发调用，返回调用 Wait 时对应的那次启动的结果
+func (e *Engine) Wait() error {
+	state := e.currentServe()
+	<-state.done
+	return state.err
+}
+
+// Run 在 EngineOptions.Addr 上提供 http 服务，阻塞直到服务退出，收到 SIGINT/SIGQUIT/SIGTERM 时优雅退出，
+// 开启 WithGracefulRestart 时收到 SIGHUP/SIGUSR2 后平滑重启
+func (e *Engine) Run() error {
+	ln, err := e.Listen("tcp", e.server.Addr)
+	if err != nil {
+		e.cleanupEndpoints()
+		return err
+	}
+	return e.RunListener(ln)
+}
+
+// RunTLS 同 Run，提供 https 服务
+func (e *Engine) RunTLS(certFile, keyFile string) error {
+	ln, err := e.Listen("tcp", e.server.Addr)
+	if err != nil {
+		e.cleanupEndpoints()
+		return err
+	}
+	e.AddTLSListener(ln, certFile, keyFile)
+	return e.run()
+}
+
+// RunUnix 同 Run，在 unix socket 上提供 http 服务，socket 文件的权限通过 WithUnixSocketMode 设置，服务退出后删除 socket 文件
+func (e *Engine) RunUnix(file string) error {
+	ln, err := e.Listen("unix", file)
+	if err != nil {
+		e.cleanupEndpoints()
+		return err
+	}
+	e.endpoints = append(e.endpoints, &endpoint{ln: ln, unixFile: file})
+	return e.run()
+}
+
+// RunListener 同 Run，在 ln 上提供 http 服务
+func (e *Engine) RunListener(ln net.Listener) error {
+	e.AddListener(ln)
+	return e.run()
+}
+
+// Listen 监听 network 上的 addr，unix socket 会使用 WithUnixSocketMode 设置的权限。
+// 开启 WithGracefulRestart 时优先使用父进程传递的监听，所以通过 AddListener 添加的监听需要通过 Listen 创建才能在重启时传递给子进程
+func (e *Engine) Listen(network, addr string) (net.Listener, error) {
+	key := listenKey(network, addr)
+	ln, ok := e.inheritedListener(key)
+	if !ok {
+		var err error
+		if network == "unix" {
+			ln, err = listenUnix(addr, e.unixSocketMode)
+		} else {
+			ln, err = net.Listen(network, addr)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	e.listenKeys[ln] = key
+	return ln, nil
+}
+
+func listenKey(network, addr string) string {
+	return network + "://" + addr
+}
+
+// inheritedListener 获取父进程传递的监听，每个监听只能被获取一次
+func (e *Engine) inheritedListener(key string) (net.Listener, bool) {
+	if !e.loadInheritedListeners() {
+		return nil, false
+	}
+	ln, ok := e.inherited[key]
+	if ok {
+		delete(e.inherited, key)
+	}
+	return ln, ok
+}
+
+// loadInheritedListeners 加载父进程传递的监听，返回当前进程是否由平滑重启创建
+func (e *Engine) loadInheritedListeners() bool {
+	if !e.gracefulRestart {
+		return false
+	}
+	e.inheritOnce.Do(func() {
+		var err error
+		if e.inherited, err = inheritListeners(); err != nil {
+			log.Errorf("Inherit listeners error: %v", err)
+		}
+	})
+	return e.inherited != nil
+}
+
+// listenUnix 监听 unix socket，上次服务异常退出时遗留的 socket 文件会被删除
+func listenUnix(file string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(file); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a unix socket", file)
+		}
+		if err := os.Remove(file); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", file)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(file, mode); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func (e *Engine) cleanupEndpoints() {
+	for _, ep := range e.endpoints {
+		ep.cleanup()
+	}
+}
+
+// run 启动服务并阻塞直到服务退出，收到退出信号时优雅退出，开启 WithGracefulRestart 时收到重启信号后平滑重启
+func (e *Engine) run() error {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, shutdownSignals...)
+	defer signal.Stop(sigCh)
+	restartCh := make(chan os.Signal, 1)
+	if e.gracefulRestart {
+		signal.Notify(restartCh, restartSignals...)
+		defer signal.Stop(restartCh)
+	}
+
+	if err := e.Start(); err != nil {
+		return err
+	}
+
+	state := e.currentServe()
+	for {
+		select {
+		case <-state.done:
+			return state.err
+		case sig := <-restartCh:
+			// 子进程开始提供服务后会通过 SIGTERM 通知当前进程优雅退出
+			log.Infof("Receive signal %v, restart server", sig)
+			if err := e.restart(); err != nil {
+				log.Errorf("Restart server error: %v", err)
+			}
+		case sig := <-sigCh:
+			log.Infof("Receive signal %v, shutdown server", sig)
+			// 关闭时的错误通过 Wait 返回
+			_ = e.shutdownOnSignal(sigCh)
+			<-state.done
+			return state.err
+		}
+	}
+}
+
+// shutdownOnSignal 优雅退出，最多等待 shutdownTimeout，期间再次收到信号时强制退出
+func (e *Engine) shutdownOnSignal(sigCh <-chan os.Signal) error {
+	ctx, cancel := e.shutdownContext(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case sig := <-sigCh:
+			log.Warnf("Receive signal %v again, close server", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return e.Shutdown(ctx)
+}
+
+// shutdownContext 最多等待 shutdownTimeout 的 context，shutdownTimeout 为 0 时不限制等待时间
+func (e *Engine) shutdownContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if e.shutdownTimeout > 0 {
+		return context.WithTimeout(parent, e.shutdownTimeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// Shutdown 优雅关闭服务：停止接收新的连接，等待进行中的请求处理完毕后执行 OnShutdown 注册的钩子。
+// ctx 超时或者被取消时强制关闭所有连接。多次调用只会执行一次，返回相同的结果。
+func (e *Engine) Shutdown(ctx context.Context) error {
+	e.shutdownOnce.Do(func() {
+		err := e.server.Shutdown(ctx)
+		if err != nil {
+			// 等待超时，强制关闭剩余的连接
+			_ = e.server.Close()
+		}
+		// 等待超时时 ctx 已经过期，钩子使用单独的 context，最多执行 shutdownTimeout
+		hookCtx, cancel := e.shutdownContext(context.Background())
+		defer cancel()
+		// 所有钩子都会被执行，返回第一个错误
+		for _, hook := range e.onShutdown {
+			if hookErr := hook(hookCtx); hookErr != nil && err == nil {
+				err = hookErr
+			}
+		}
+		e.shutdownErr = err
+	})
+	return e.shutdownErr
+}
@@ -0,0 +1,259 @@
+package mini_gin
+
+import (
+	"context"
+	"errors"
+	"github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// serve 在随机端口上启动服务，返回服务地址
+func serve(e *Engine) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	e.server.Handler = e
+	go func() { _ = e.server.Serve(ln) }()
+	return "http://" + ln.Addr().String()
+}
+
+func TestEngine_Shutdown(t *testing.T) {
+	convey.Convey("", t, func() {
+		convey.Convey("drain in-flight requests before shutdown hooks", func() {
+			app := New()
+			started := make(chan struct{})
+			app.GET("/slow", func(ctx *Context) {
+				close(started)
+				time.Sleep(100 * time.Millisecond)
+				_, _ = ctx.Write([]byte("done"))
+			})
+			var trace []string
+			hookErr := errors.New("close db error")
+			app.OnShutdown(func(ctx context.Context) error {
+				trace = append(trace, "db")
+				return hookErr
+			}, func(ctx context.Context) error {
+				trace = append(trace, "log")
+				return nil
+			})
+
+			addr := serve(app)
+			bodyCh := make(chan string, 1)
+			go func() {
+				resp, err := http.Get(addr + "/slow")
+				if err != nil {
+					bodyCh <- err.Error()
+					return
+				}
+				defer resp.Body.Close()
+				body, _ := ioutil.ReadAll(resp.Body)
+				bodyCh <- string(body)
+			}()
+			<-started
+
+			convey.So(app.Shutdown(context.Background()), convey.ShouldEqual, hookErr)
+			convey.So(<-bodyCh, convey.ShouldEqual, "done")
+			convey.So(trace, convey.ShouldResemble, []string{"db", "log"})
+			// 多次调用只会执行一次
+			convey.So(app.Shutdown(context.Background()), convey.ShouldEqual, hookErr)
+			convey.So(trace, convey.ShouldResemble, []string{"db", "log"})
+		})
+
+		convey.Convey("close connections after timeout", func() {
+			app := New()
+			started := make(chan struct{})
+			release := make(chan struct{})
+			app.GET("/slow", func(ctx *Context) {
+				close(started)
+				<-release
+			})
+			hookCalled := false
+			var hookCtxErr error
+			app.OnShutdown(func(ctx context.Context) error {
+				hookCalled = true
+				hookCtxErr = ctx.Err()
+				return nil
+			})
+
+			addr := serve(app)
+			errCh := make(chan error, 1)
+			go func() {
+				resp, err := http.Get(addr + "/slow")
+				if err == nil {
+					resp.Body.Close()
+				}
+				errCh <- err
+			}()
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			convey.So(app.Shutdown(ctx), convey.ShouldResemble, context.DeadlineExceeded)
+			convey.So(<-errCh, convey.ShouldNotBeNil)
+			convey.So(hookCalled, convey.ShouldBeTrue)
+			// 等待超时不影响钩子的 ctx
+			convey.So(hookCtxErr, convey.ShouldBeNil)
+			close(release)
+		})
+	})
+}
+
+func TestEngine_RunVariants(t *testing.T) {
+	convey.Convey("", t, func() {
+		app := New()
+		app.GET("/ping", func(ctx *Context) {
+			_, _ = ctx.Write([]byte("pong"))
+		})
+		// OnStart 执行时已经完成监听
+		ready := make(chan struct{})
+		app.OnStart(func(ctx context.Context) error {
+			close(ready)
+			return nil
+		})
+
+		get := func(client *http.Client, url string) string {
+			resp, err := client.Get(url)
+			if err != nil {
+				return err.Error()
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			return string(body)
+		}
+
+		convey.Convey("multiple listeners", func() {
+			ln1, _ := net.Listen("tcp", "127.0.0.1:0")
+			ln2, _ := net.Listen("tcp", "127.0.0.1:0")
+			app.AddListener(ln1)
+			app.AddListener(ln2)
+			convey.So(app.Start(), convey.ShouldBeNil)
+			<-ready
+
+			convey.So(get(http.DefaultClient, "http://"+ln1.Addr().String()+"/ping"), convey.ShouldEqual, "pong")
+			convey.So(get(http.DefaultClient, "http://"+ln2.Addr().String()+"/ping"), convey.ShouldEqual, "pong")
+			convey.So(app.Start(), convey.ShouldNotBeNil)
+			convey.So(app.Shutdown(context.Background()), convey.ShouldBeNil)
+			convey.So(app.Wait(), convey.ShouldBeNil)
+			_, err := net.Dial("tcp", ln2.Addr().String())
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("unix socket", func() {
+			dir, _ := ioutil.TempDir("", "mini_gin")
+			defer os.RemoveAll(dir)
+			file := filepath.Join(dir, "app.sock")
+			// 上次异常退出时遗留的 socket 文件
+			stale, _ := net.Listen("unix", file)
+			stale.(*net.UnixListener).SetUnlinkOnClose(false)
+			_ = stale.Close()
+
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- app.RunUnix(file)
+			}()
+			<-ready
+
+			client := &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return net.Dial("unix", file)
+				},
+			}}
+			convey.So(get(client, "http://unix/ping"), convey.ShouldEqual, "pong")
+			info, err := os.Stat(file)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(info.Mode().Perm(), convey.ShouldEqual, os.FileMode(0660))
+
+			convey.So(app.Shutdown(context.Background()), convey.ShouldBeNil)
+			convey.So(<-errCh, convey.ShouldBeNil)
+			_, err = os.Stat(file)
+			convey.So(os.IsNotExist(err), convey.ShouldBeTrue)
+		})
+	})
+}
+
+func TestEngine_StartError(t *testing.T) {
+	convey.Convey("", t, func() {
+		convey.Convey("address in use", func() {
+			ln, _ := net.Listen("tcp", "127.0.0.1:0")
+			defer ln.Close()
+			app := NewWithCfg(WithAddr(ln.Addr().String()))
+			convey.So(app.Start(), convey.ShouldNotBeNil)
+			convey.So(app.Run(), convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("start hook error", func() {
+			app := New()
+			hookErr := errors.New("connect db error")
+			app.OnStart(func(ctx context.Context) error {
+				return hookErr
+			})
+			ln, _ := net.Listen("tcp", "127.0.0.1:0")
+			convey.So(app.RunListener(ln), convey.ShouldEqual, hookErr)
+			// 启动失败时关闭监听
+			_, err := net.Dial("tcp", ln.Addr().String())
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("retry after start error", func() {
+			app := NewWithCfg(WithAddr("127.0.0.1:0"))
+			hookErr := errors.New("connect db error")
+			app.OnStart(func(ctx context.Context) error {
+				err := hookErr
+				hookErr = nil
+				return err
+			})
+			startErr := app.Start()
+			convey.So(startErr, convey.ShouldNotBeNil)
+			// 启动失败后 Wait 直接返回启动时的错误
+			convey.So(app.Wait(), convey.ShouldEqual, startErr)
+
+			// 与重新启动并发的 Wait 返回之前启动失败的错误或者重新启动后的结果
+			waitCh := make(chan error, 1)
+			go func() { waitCh <- app.Wait() }()
+			convey.So(app.Start(), convey.ShouldBeNil)
+			convey.So(app.Shutdown(context.Background()), convey.ShouldBeNil)
+			convey.So(app.Wait(), convey.ShouldBeNil)
+			convey.So(<-waitCh, convey.ShouldBeIn, []error{startErr, nil})
+		})
+
+		convey.Convey("endpoint error with stuck request", func() {
+			app := NewWithCfg(WithShutdownTimeout(100 * time.Millisecond))
+			started, unblock := make(chan struct{}), make(chan struct{})
+			defer close(unblock)
+			app.GET("/stuck", func(ctx *Context) {
+				close(started)
+				<-unblock
+			})
+			ln, _ := net.Listen("tcp", "127.0.0.1:0")
+			app.AddListener(ln)
+			convey.So(app.Start(), convey.ShouldBeNil)
+			go func() { _, _ = http.Get("http://" + ln.Addr().String() + "/stuck") }()
+			<-started
+
+			// 监听异常关闭，最多等待 shutdownTimeout 后强制关闭
+			_ = ln.Close()
+			waitCh := make(chan error, 1)
+			go func() { waitCh <- app.Wait() }()
+			select {
+			case err := <-waitCh:
+				convey.So(err, convey.ShouldNotBeNil)
+			case <-time.After(5 * time.Second):
+				t.Fatal("Wait does not return after endpoint error")
+			}
+		})
+
+		convey.Convey("invalid certificate", func() {
+			app := New()
+			ln, _ := net.Listen("tcp", "127.0.0.1:0")
+			app.AddTLSListener(ln, "not/exist/cert.pem", "not/exist/key.pem")
+			convey.So(app.Start(), convey.ShouldNotBeNil)
+		})
+	})
+}
@@ -3,6 +3,7 @@ package mini_gin
 import (
 	"fmt"
 	"github.com/WANGgbin/mini_gin/util"
+	"regexp"
 	"strings"
 )
 
@@ -14,7 +15,23 @@ import (
 	/a/prefix:key1 /a/prefix1:key2 right
 	/a/prefix:key1 /a/:key	right
 
-2. 。。。
+2. catch-all 通配符 '*key' 匹配剩余的全部路径(包含 '/')，只能出现在路由的最后一个 segment
+	eg:
+	/static/*filepath	right
+	/static/*filepath/a	wrong
+
+3. 同一位置上只能有一个通配符，无论是 ':' 还是 '*'，约束不同的 ':' 通配符除外(见 4)
+	eg:
+	/a/:key /a/*key	conflict
+	/a/*key1 /a/*key2	conflict
+	/a/b /a/*key	right，静态路由优先级更高
+
+4. ':' 通配符可以通过 '<>' 添加约束，约束可以是预定义的类型(见 predefinedConstraints)或者正则表达式，
+   约束不满足时，继续尝试优先级更低的节点。同一位置约束不同的通配符可以共存，优先级：有约束 > 无约束 > catch-all
+	eg:
+	/users/:id<int> /users/:name<[a-z]+>	right
+	/users/:id<int> /users/:name	right
+	/users/:id<int> /users/:uid<int>	conflict
 */
 
 func newTrieTree() *trieTree {
@@ -30,7 +47,13 @@ type trieTree struct {
 }
 
 func (tree *trieTree) insert(route string, handlers ...MiddleWare) {
+	tree.insertRoute(route, handlers, nil)
+}
+
+// insertRoute 插入路由，r 记录路由所属的路由组，用于在 Engine.Freeze 时编译完整的 handlers
+func (tree *trieTree) insertRoute(route string, handlers []MiddleWare, r *Route) {
 	util.Assert(len(handlers) > 0, "handlers should not be empty")
+	validateCatchAll(route)
 
 	curNode := tree.root
 	curIndex := 0
@@ -47,7 +70,7 @@ func (tree *trieTree) insert(route string, handlers ...MiddleWare) {
 					panic(fmt.Sprintf("route %s has been registered", route))
 				}
 				// 否则，标记当前节点为有效路由
-				curNode.setRoute(handlers)
+				curNode.setRoute(route, handlers, r)
 				return
 			}
 			// route 未匹配完毕，寻找子孩子节点
@@ -58,41 +81,108 @@ func (tree *trieTree) insert(route string, handlers ...MiddleWare) {
 				continue
 			}
 			// 未找到，插入新节点
-			curNode.addChild(newNode(route[curIndex:], handlers, route))
+			curNode.checkWildCardConflict(route[curIndex:], route)
+			curNode.addChild(newRouteNode(route[curIndex:], handlers, route, r))
 			return
 		}
 
 		// 分裂当前节点
 		curNode.split(lenOfPrefix)
 		if curIndex < len(route) {
-			curNode.addChild(newNode(route[curIndex:], handlers, route))
+			curNode.checkWildCardConflict(route[curIndex:], route)
+			curNode.addChild(newRouteNode(route[curIndex:], handlers, route, r))
 		} else {
-			curNode.setRoute(handlers)
+			curNode.setRoute(route, handlers, r)
 		}
 		return
 	}
 }
 
-type pathInfo struct {
-	handlers []MiddleWare      // url handlers
-	params   map[string]string // url 参数
+// validateCatchAll 校验 catch-all 通配符：key 不能为空，且必须位于路由的最后一个 segment
+func validateCatchAll(route string) {
+	for _, dynKey := range parseDynKeys(route) {
+		if !isCatchAll(route[dynKey[0]]) {
+			continue
+		}
+
+		key := route[dynKey[0] : dynKey[1]+1]
+		if dynKey[0] == dynKey[1] {
+			panic(fmt.Sprintf("catch-all key in path: %s should not be empty", route))
+		}
+
+		if dynKey[1] != len(route)-1 {
+			panic(fmt.Sprintf("catch-all key %s must be at the end of path: %s", key, route))
+		}
+
+		if strings.IndexByte(key, '<') != -1 {
+			panic(fmt.Sprintf("catch-all key %s in path: %s does not support constraint", key, route))
+		}
+	}
+}
+
+// isEmpty 判断路由树中是否注册了路由
+func (tree *trieTree) isEmpty() bool {
+	return len(tree.root.children) == 0 && !tree.root.isRoute()
+}
+
+// walk 深度优先遍历路由树中所有有效的路由，fn 的参数为完整路由以及对应的节点
+func (tree *trieTree) walk(fn func(route string, n *node)) {
+	tree.root.walk("", fn)
 }
 
-// getRouteInfo 获取与 route 对应的 handlers & params
-func (tree *trieTree) getRouteInfo(route string) *pathInfo {
-	return tree.root.getRouteInfo(route)
+// Param 路由的一个动态参数
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params 路由的所有动态参数，按照在路由中出现的顺序排列。
+// 使用 slice 而不是 map，可以在 Context 中复用，避免每次请求分配内存
+type Params []Param
+
+// Get 获取 key 对应的参数值，参数不存在时第二个返回值为 false
+func (ps Params) Get(key string) (string, bool) {
+	for _, param := range ps {
+		if param.Key == key {
+			return param.Value, true
+		}
+	}
+	return "", false
+}
+
+// ByName 获取 key 对应的参数值，参数不存在时返回空字符串
+func (ps Params) ByName(key string) string {
+	value, _ := ps.Get(key)
+	return value
+}
+
+// getRouteInfo 获取与 route 对应的 handlers，动态参数追加到 params 中，未找到返回 nil
+func (tree *trieTree) getRouteInfo(route string, params *Params) []MiddleWare {
+	if n := tree.getRoute(route, params); n != nil {
+		return n.handlers
+	}
+	return nil
+}
+
+// getRoute 获取与 route 匹配的路由节点，动态参数追加到 params 中，未找到返回 nil
+func (tree *trieTree) getRoute(route string, params *Params) *node {
+	return tree.root.getRoute(route, params)
 }
 
 type node struct {
 	handlers []MiddleWare
+	// route 节点对应的路由，Engine.Freeze 时根据 route 所属的路由组编译完整的 handlers
+	route *Route
 
-	// 动态参数的索引，用于记录当前节点是否有动态参数，目前仅支持通配符 ':'
+	// 动态参数的索引，用于记录当前节点是否有动态参数，支持通配符 ':' 以及 catch-all 通配符 '*'
 	// 例子：
 	// /:key1/a:key2
 	// dynKeys = [][2]int{{1, 5}, {8, 12}}
 	// 无论在插入还是查找的时候，通过该参数可以很方便的进行判断是否冲突以及是否匹配
 	dynKeys [][2]int
-	content string
+	// 与 dynKeys 一一对应，记录每个动态参数的约束，没有约束为 nil
+	constraints []*regexp.Regexp
+	content     string
 	// 用于打印报错信息
 	fullPath string
 
@@ -110,26 +200,97 @@ func newNode(route string, handlers []MiddleWare, fullPath string) *node {
 	return n
 }
 
-// parseDynKeyFromRoute 从 route 解析出所有的动态参数的起始/结束索引
+func newRouteNode(route string, handlers []MiddleWare, fullPath string, r *Route) *node {
+	n := newNode(route, handlers, fullPath)
+	n.route = r
+	return n
+}
+
+// parseDynKeyFromRoute 从 route 解析出所有的动态参数的起始/结束索引以及约束
 func (n *node) parseDynKeyFromRoute(route string) {
+	n.dynKeys = parseDynKeys(route)
+	n.constraints = nil
+
+	for idx, dynKey := range n.dynKeys {
+		_, constraint := splitDynKey(route[dynKey[0] : dynKey[1]+1])
+		if constraint == "" {
+			continue
+		}
+
+		if n.constraints == nil {
+			n.constraints = make([]*regexp.Regexp, len(n.dynKeys))
+		}
+		n.constraints[idx] = compileConstraint(constraint, n.fullPath)
+	}
+}
+
+// parseDynKeys 解析出所有的动态参数的起始/结束索引。动态参数以 '/' 结束，参数内部的通配符(eg: 约束中的正则表达式)会被忽略
+func parseDynKeys(route string) [][2]int {
+	var dynKeys [][2]int
 	isInDynKey := false
 	start := 0
-	n.dynKeys = nil
 
-	for index, char := range route {
-		if char == ':' {
+	for index := 0; index < len(route); index++ {
+		char := route[index]
+		if isWildCard(char) && !isInDynKey {
 			isInDynKey = true
 			start = index
 		} else if char == '/' && isInDynKey {
-			n.dynKeys = append(n.dynKeys, [2]int{start, index - 1})
+			dynKeys = append(dynKeys, [2]int{start, index - 1})
 			start = 0
 			isInDynKey = false
 		}
 	}
 
 	if isInDynKey {
-		n.dynKeys = append(n.dynKeys, [2]int{start, len(route) - 1})
+		dynKeys = append(dynKeys, [2]int{start, len(route) - 1})
+	}
+	return dynKeys
+}
+
+// splitDynKey 将动态参数拆分为参数名以及约束，eg: ':id<int>' => 'id', 'int'
+func splitDynKey(dynKey string) (string, string) {
+	index := strings.IndexByte(dynKey, '<')
+	if index == -1 || dynKey[len(dynKey)-1] != '>' {
+		return dynKey[1:], ""
+	}
+	return dynKey[1:index], dynKey[index+1 : len(dynKey)-1]
+}
+
+// getDynKeyName 获取第 idx 个动态参数的参数名
+func (n *node) getDynKeyName(idx int) string {
+	name, _ := splitDynKey(n.content[n.dynKeys[idx][0] : n.dynKeys[idx][1]+1])
+	return name
+}
+
+// matchConstraint 判断第 idx 个动态参数的值是否满足约束
+func (n *node) matchConstraint(idx int, value string) bool {
+	if n.constraints == nil || n.constraints[idx] == nil {
+		return true
 	}
+	return n.constraints[idx].MatchString(value)
+}
+
+// predefinedConstraints 预定义的约束类型
+var predefinedConstraints = map[string]string{
+	"int":   `-?[0-9]+`,
+	"uint":  `[0-9]+`,
+	"alpha": `[a-zA-Z]+`,
+	"alnum": `[a-zA-Z0-9]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+// compileConstraint 编译约束，约束需要匹配参数的完整值
+func compileConstraint(constraint string, fullPath string) *regexp.Regexp {
+	if expr, ok := predefinedConstraints[constraint]; ok {
+		constraint = expr
+	}
+
+	reg, err := regexp.Compile("^(?:" + constraint + ")$")
+	if err != nil {
+		panic(fmt.Sprintf("constraint <%s> in path: %s is invalid: %v", constraint, fullPath, err))
+	}
+	return reg
 }
 
 // getLenOfPrefix 获取当前节点 content 跟 route 的最大前缀长度
@@ -139,33 +300,56 @@ func (n *node) getLenOfPrefix(route string, fullPath string) int {
 
 	for ; curIndex < len(n.content) && curIndex < len(route); curIndex++ {
 		if n.content[curIndex] != route[curIndex] {
+			// 同一位置不允许出现两种不同的通配符
+			if isWildCard(n.content[curIndex]) && isWildCard(route[curIndex]) {
+				panicWildCardConflict(route[curIndex:], fullPath, n.content[curIndex:], n.fullPath)
+			}
 			break
 		}
 
-		// 每个节点中如果存在通配符，则一定存储 key 的完整格式: ':key'
+		// 每个节点中如果存在通配符，则一定存储 key 的完整格式: ':key' 或者 '*key'
 		// 如果存储不完整的格式，意味着出现了多个相同前缀的 key，这显然是不对的。
-		if n.content[curIndex] == ':' {
-			oldRouteKey := getSubStrBeforeFirstSlash(n.content[curIndex+1:])
-			newRouteKey := getSubStrBeforeFirstSlash(route[curIndex+1:])
+		if isWildCard(n.content[curIndex]) {
+			oldRouteKey := getSubStrBeforeFirstSlash(n.content[curIndex:])
+			newRouteKey := getSubStrBeforeFirstSlash(route[curIndex:])
 
-			// key 不相同直接 panic
 			if oldRouteKey != newRouteKey {
-				panic(
-					fmt.Sprintf("key: %s in new path: %s is conflict with existing key %s in existing path: %s",
-						route[curIndex:curIndex+len(newRouteKey)+1],
-						fullPath,
-						n.content[curIndex:curIndex+len(oldRouteKey)+1],
-						n.fullPath,
-					),
-				)
+				// 约束不同的通配符可以共存，从通配符之前分裂节点
+				_, oldConstraint := splitDynKey(oldRouteKey)
+				_, newConstraint := splitDynKey(newRouteKey)
+				if oldConstraint != newConstraint {
+					break
+				}
+				// 否则 key 不相同直接 panic
+				panicWildCardConflict(route[curIndex:], fullPath, n.content[curIndex:], n.fullPath)
 			}
-			curIndex += len(oldRouteKey)
+			curIndex += len(oldRouteKey) - 1
 		}
 	}
 
 	return curIndex
 }
 
+func panicWildCardConflict(newKey, newPath, oldKey, oldPath string) {
+	panic(
+		fmt.Sprintf("key: %s in new path: %s is conflict with existing key %s in existing path: %s",
+			getSubStrBeforeFirstSlash(newKey),
+			newPath,
+			getSubStrBeforeFirstSlash(oldKey),
+			oldPath,
+		),
+	)
+}
+
+// isWildCard 判断字符是否为通配符
+func isWildCard(char byte) bool {
+	return char == ':' || char == '*'
+}
+
+func isCatchAll(char byte) bool {
+	return char == '*'
+}
+
 func getSubStrBeforeFirstSlash(str string) string {
 	index := strings.Index(str, "/")
 	if index == -1 {
@@ -179,35 +363,110 @@ func (n *node) isRoute() bool {
 	return len(n.handlers) > 0
 }
 
-func (n *node) setRoute(handlers []MiddleWare) {
+// setRoute 将 n 标记为路由 fullPath，n 可能是之前注册其他路由时拆分出来的节点，fullPath 需要同时更新
+func (n *node) setRoute(fullPath string, handlers []MiddleWare, r *Route) {
 	n.handlers = handlers
+	n.route = r
+	n.fullPath = fullPath
 }
 
-// findNextNode 注册路由的时候，寻找下一个匹配的节点
+// findNextNode 注册路由的时候，寻找下一个匹配的节点。
+// 如果 route 以 ':' 开始，只有约束相同的孩子节点才匹配
 func (n *node) findNextNode(route string) *node {
 	for _, child := range n.children {
-		if child.content[0] == route[0] {
-			return child
+		if child.content[0] != route[0] {
+			continue
+		}
+
+		if route[0] == ':' && !isSameConstraint(child.content, route) {
+			continue
 		}
+		return child
 	}
 	return nil
 }
 
+// isSameConstraint 判断两个以通配符开始的路由，第一个通配符的约束是否相同
+func isSameConstraint(route1, route2 string) bool {
+	_, constraint1 := splitDynKey(getSubStrBeforeFirstSlash(route1))
+	_, constraint2 := splitDynKey(getSubStrBeforeFirstSlash(route2))
+	return constraint1 == constraint2
+}
+
+func (n *node) walk(prefix string, fn func(route string, n *node)) {
+	route := prefix + n.content
+	if n.isRoute() {
+		fn(route, n)
+	}
+	for _, child := range n.children {
+		child.walk(route, fn)
+	}
+}
+
+// checkWildCardConflict 插入新的孩子节点前，校验其通配符是否与已有孩子节点冲突。
+// 同一位置上至多存在一个通配符孩子节点，约束不同的 ':' 通配符除外。
+func (n *node) checkWildCardConflict(route string, fullPath string) {
+	if !isWildCard(route[0]) {
+		return
+	}
+
+	for _, child := range n.children {
+		if !isWildCard(child.content[0]) {
+			continue
+		}
+
+		if isCatchAll(route[0]) || isCatchAll(child.content[0]) || isSameConstraint(child.content, route) {
+			panicWildCardConflict(route, fullPath, child.content, child.fullPath)
+		}
+	}
+}
+
+// addChild 按照优先级插入孩子节点：静态节点 > 有约束的通配符节点 > 无约束的通配符节点 > catch-all 节点，
+// 优先级相同的按照插入顺序排列，匹配路由时按照该顺序依次尝试
 func (n *node) addChild(child *node) {
-	n.children = append(n.children, child)
+	priority := child.priority()
+	index := len(n.children)
+	for index > 0 && n.children[index-1].priority() > priority {
+		index--
+	}
+
+	n.children = append(n.children, nil)
+	copy(n.children[index+1:], n.children[index:])
+	n.children[index] = child
 	child.parent = n
 }
 
+// priority 节点匹配的优先级，值越小优先级越高
+func (n *node) priority() int {
+	switch {
+	case isCatchAll(n.content[0]):
+		return 3
+	case n.content[0] == ':' && (n.constraints == nil || n.constraints[0] == nil):
+		return 2
+	case n.content[0] == ':':
+		return 1
+	default:
+		return 0
+	}
+}
+
 // split 从 n 拆分出子节点, 子节点路径为 n.content[curIndex:]
 func (n *node) split(curIndex int) {
 	child := &node{
 		handlers: n.handlers,
+		route:    n.route,
 		content:  n.content[curIndex:],
+		fullPath: n.fullPath,
 		parent:   n,
 		children: n.children,
 	}
 
+	for _, grandChild := range child.children {
+		grandChild.parent = child
+	}
+
 	n.handlers = nil
+	n.route = nil
 	n.children = []*node{child}
 	n.content = n.content[:curIndex]
 
@@ -219,49 +478,62 @@ func (n *node) split(curIndex int) {
 	return
 }
 
-// getRouteInfo 获取与 route 匹配的路由信息，未找到返回 nil
-func (n *node) getRouteInfo(route string) *pathInfo {
-	nextIndex, params := n.match(route)
+// getRoute 获取与 route 匹配的路由节点，动态参数追加到 params 中，未找到返回 nil。
+// 匹配失败时，params 恢复为调用前的状态
+func (n *node) getRoute(route string, params *Params) *node {
+	length := len(*params)
+	nextIndex := n.match(route, params)
 	if nextIndex == -1 {
+		*params = (*params)[:length]
 		return nil
 	}
 
 	if nextIndex == len(route) {
 		if n.isRoute() {
-			return &pathInfo{params: params, handlers: n.handlers}
+			return n
+		}
+		// catch-all 通配符可以匹配空路径，eg: /static/*filepath 匹配 /static/
+		if child := n.getCatchAllChild(); child != nil {
+			if found := child.getRoute("", params); found != nil {
+				return found
+			}
 		}
+		*params = (*params)[:length]
 		return nil
 	}
 
-	candidateNodes := n.findCandidateNodes(route[nextIndex:])
-
-	for _, candidate := range candidateNodes {
-		info := candidate.getRouteInfo(route[nextIndex:])
-		if info != nil {
-			util.MergeParam(&params, info.params)
-			return &pathInfo{handlers: info.handlers, params: params}
+	// 寻找符合要求的孩子节点，可能存在多个匹配的孩子节点。
+	// 需要特别注意优先级：孩子节点已经按照优先级排列，通配符的孩子节点优先级低于静态节点。
+	route = route[nextIndex:]
+	for _, child := range n.children {
+		if !isWildCard(child.content[0]) && child.content[0] != route[0] {
+			continue
+		}
+		if found := child.getRoute(route, params); found != nil {
+			return found
 		}
 	}
+
+	*params = (*params)[:length]
 	return nil
 }
 
 // match 判断 route 是否跟节点 n 匹配，如果匹配，则返回 route 新的索引，用于后续判断.
-// 同时 返回动态参数。如果不匹配，则返回索引为 -1.
-func (n *node) match(route string) (int, map[string]string) {
+// 同时 将动态参数追加到 params。如果不匹配，则返回索引为 -1，此时 params 可能被追加了部分参数，由调用方恢复.
+func (n *node) match(route string, params *Params) int {
 	// 如果没有动态参数，直接匹配
 	if len(n.dynKeys) == 0 {
 		if strings.HasPrefix(route, n.content) {
-			return len(n.content), nil
+			return len(n.content)
 		}
-		return -1, nil
+		return -1
 	}
 
-	var params map[string]string
 	curIndex := 0
 
 	if n.dynKeys[0][0] > 0 {
-		if route[curIndex:n.dynKeys[0][0]] != n.content[:n.dynKeys[0][0]] {
-			return -1, nil
+		if !strings.HasPrefix(route, n.content[:n.dynKeys[0][0]]) {
+			return -1
 		}
 		curIndex += n.dynKeys[0][0]
 	}
@@ -275,8 +547,12 @@ func (n *node) match(route string) (int, map[string]string) {
 		}
 
 		var value string
-		if subStr == "" {
-			nextSlashIndex := strings.Index(route[curIndex:], "/")
+		if isCatchAll(n.content[dynKey[0]]) {
+			// catch-all 通配符一定位于路由末尾，匹配剩余的全部路径
+			value = route[curIndex:]
+			curIndex = len(route)
+		} else if subStr == "" {
+			nextSlashIndex := strings.IndexByte(route[curIndex:], '/')
 			if nextSlashIndex == -1 {
 				value = route[curIndex:]
 				curIndex = len(route)
@@ -287,44 +563,165 @@ func (n *node) match(route string) (int, map[string]string) {
 		} else {
 			subIndex := strings.Index(route[curIndex:], subStr)
 			if subIndex == -1 {
-				return -1, nil
+				return -1
 			}
 			value = route[curIndex : curIndex+subIndex]
 			curIndex += subIndex + len(subStr)
 		}
 
-		if params == nil {
-			// 延迟创建
-			params = make(map[string]string)
+		if !n.matchConstraint(idx, value) {
+			return -1
 		}
-		key := n.content[dynKey[0]+1 : dynKey[1]+1]
-		params[key] = value
+
+		// params 的容量在分配 Context 时已经按照最大参数数量预留，这里不会发生内存分配
+		*params = append(*params, Param{Key: n.getDynKeyName(idx), Value: value})
 	}
 
-	return curIndex, params
+	return curIndex
 }
 
-// findCandidateNodes 匹配路由的时候，寻找符合要求的孩子节点。可能存在两个匹配的孩子节点。
-// 需要特别注意优先级：通配符的孩子节点优先级最低。
-func (n *node) findCandidateNodes(route string) []*node {
-	var nodeBeginWithWildCard *node
-	var candidateNodes []*node
+// getCatchAllChild 获取以 catch-all 通配符开始的孩子节点
+func (n *node) getCatchAllChild() *node {
 	for _, child := range n.children {
-		if child.content[0] == route[0] {
-			candidateNodes = append(candidateNodes, child)
+		if isCatchAll(child.content[0]) {
+			return child
+		}
+	}
+	return nil
+}
+
+// findCaseInsensitivePath 忽略大小写查找 route 对应的路由，返回修正后的路由：
+// 静态部分使用注册时的大小写，动态参数保留请求中的原值。
+// fixTrailingSlash 为 true 时，同时尝试增加/删除末尾的 '/'
+func (tree *trieTree) findCaseInsensitivePath(route string, fixTrailingSlash bool) (string, bool) {
+	buf, found := tree.root.findCaseInsensitivePath(route, make([]byte, 0, len(route)+1))
+	if found {
+		return string(buf), true
+	}
+
+	if fixTrailingSlash && route != "/" {
+		buf, found = tree.root.findCaseInsensitivePath(toggleTrailingSlash(route), buf[:0])
+		if found {
+			return string(buf), true
+		}
+	}
+	return "", false
+}
+
+// findCaseInsensitivePath 与 getRoute 的匹配逻辑一致，只是静态部分忽略大小写，并将修正后的路由追加到 buf
+func (n *node) findCaseInsensitivePath(route string, buf []byte) ([]byte, bool) {
+	nextIndex, buf := n.matchCaseInsensitive(route, buf)
+	if nextIndex == -1 {
+		return buf, false
+	}
+
+	if nextIndex == len(route) {
+		if n.isRoute() {
+			return buf, true
+		}
+		if child := n.getCatchAllChild(); child != nil && child.isRoute() {
+			return buf, true
+		}
+		return buf, false
+	}
+
+	route = route[nextIndex:]
+	length := len(buf)
+	// 静态孩子节点优先级更高
+	for _, child := range n.children {
+		if !isWildCard(child.content[0]) && equalFoldByte(child.content[0], route[0]) {
+			if fixed, found := child.findCaseInsensitivePath(route, buf[:length]); found {
+				return fixed, true
+			}
+		}
+	}
+	for _, child := range n.children {
+		if isWildCard(child.content[0]) {
+			if fixed, found := child.findCaseInsensitivePath(route, buf[:length]); found {
+				return fixed, true
+			}
+		}
+	}
+	return buf[:length], false
+}
+
+// matchCaseInsensitive 忽略大小写判断 route 是否跟节点 n 匹配，逻辑同 match
+func (n *node) matchCaseInsensitive(route string, buf []byte) (int, []byte) {
+	if len(n.dynKeys) == 0 {
+		if len(route) >= len(n.content) && strings.EqualFold(route[:len(n.content)], n.content) {
+			return len(n.content), append(buf, n.content...)
+		}
+		return -1, buf
+	}
+
+	curIndex := n.dynKeys[0][0]
+	if len(route) < curIndex || !strings.EqualFold(route[:curIndex], n.content[:curIndex]) {
+		return -1, buf
+	}
+	buf = append(buf, n.content[:curIndex]...)
+
+	for idx, dynKey := range n.dynKeys {
+		var subStr string
+		if idx < len(n.dynKeys)-1 {
+			subStr = n.content[dynKey[1]+1 : n.dynKeys[idx+1][0]]
 		} else {
-			if child.content[0] == ':' {
-				nodeBeginWithWildCard = child
+			subStr = n.content[dynKey[1]+1:]
+		}
+
+		var value string
+		if isCatchAll(n.content[dynKey[0]]) {
+			value = route[curIndex:]
+			curIndex = len(route)
+		} else if subStr == "" {
+			nextSlashIndex := strings.IndexByte(route[curIndex:], '/')
+			if nextSlashIndex == -1 {
+				nextSlashIndex = len(route) - curIndex
 			}
+			value = route[curIndex : curIndex+nextSlashIndex]
+			curIndex += nextSlashIndex
+		} else {
+			subIndex := indexFold(route[curIndex:], subStr)
+			if subIndex == -1 {
+				return -1, buf
+			}
+			value = route[curIndex : curIndex+subIndex]
+			curIndex += subIndex + len(subStr)
 		}
+
+		if !n.matchConstraint(idx, value) {
+			return -1, buf
+		}
+		buf = append(buf, value...)
+		buf = append(buf, subStr...)
 	}
 
-	if nodeBeginWithWildCard != nil {
-		candidateNodes = append(candidateNodes, nodeBeginWithWildCard)
+	return curIndex, buf
+}
+
+// indexFold 忽略大小写查找 subStr 在 str 中第一次出现的位置，不存在返回 -1
+func indexFold(str, subStr string) int {
+	for index := 0; index+len(subStr) <= len(str); index++ {
+		if strings.EqualFold(str[index:index+len(subStr)], subStr) {
+			return index
+		}
 	}
+	return -1
+}
 
-	// 最多存在两个节点
-	util.Assert(len(candidateNodes) <= 2, fmt.Sprintf("candidateNodes must be less than 2"))
+func equalFoldByte(a, b byte) bool {
+	if 'A' <= a && a <= 'Z' {
+		a += 'a' - 'A'
+	}
+	if 'A' <= b && b <= 'Z' {
+		b += 'a' - 'A'
+	}
+	return a == b
+}
 
-	return candidateNodes
+// toggleTrailingSlash 增加或删除 route 末尾的 '/'
+func toggleTrailingSlash(route string) string {
+	if strings.HasSuffix(route, "/") {
+		return route[:len(route)-1]
+	}
+	return route + "/"
 }
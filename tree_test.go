@@ -72,6 +72,108 @@ func Test_trieTree_insert(t *testing.T) {
 				},
 				shouldPanic: true,
 			},
+			{
+				name: "catch-all not at the end",
+				pathHandlersPairs: []struct {
+					path     string
+					handlers []MiddleWare
+				}{
+					{
+						path:     "/static/*filepath/a",
+						handlers: []MiddleWare{fakeHandler},
+					},
+				},
+				shouldPanic: true,
+			},
+			{
+				name: "catch-all & key in same position",
+				pathHandlersPairs: []struct {
+					path     string
+					handlers []MiddleWare
+				}{
+					{
+						path:     "/static/:key",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						path:     "/static/*filepath",
+						handlers: []MiddleWare{fakeHandler},
+					},
+				},
+				shouldPanic: true,
+			},
+			{
+				name: "catch-all & key in same position after split",
+				pathHandlersPairs: []struct {
+					path     string
+					handlers []MiddleWare
+				}{
+					{
+						path:     "/static/a",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						path:     "/static/*filepath",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						path:     "/static/:key",
+						handlers: []MiddleWare{fakeHandler},
+					},
+				},
+				shouldPanic: true,
+			},
+			{
+				name: "different catch-all key",
+				pathHandlersPairs: []struct {
+					path     string
+					handlers []MiddleWare
+				}{
+					{
+						path:     "/static/*filepath",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						path:     "/static/*rest",
+						handlers: []MiddleWare{fakeHandler},
+					},
+				},
+				shouldPanic: true,
+			},
+			{
+				name: "same constraint & different key",
+				pathHandlersPairs: []struct {
+					path     string
+					handlers []MiddleWare
+				}{
+					{
+						path:     "/users/:id<int>",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						path:     "/users/:name<[a-z]+>",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						path:     "/users/:uid<int>/profile",
+						handlers: []MiddleWare{fakeHandler},
+					},
+				},
+				shouldPanic: true,
+			},
+			{
+				name: "invalid constraint",
+				pathHandlersPairs: []struct {
+					path     string
+					handlers []MiddleWare
+				}{
+					{
+						path:     "/users/:id<[0-9>",
+						handlers: []MiddleWare{fakeHandler},
+					},
+				},
+				shouldPanic: true,
+			},
 			{
 				name: "regular",
 				pathHandlersPairs: []struct {
@@ -106,6 +208,30 @@ func Test_trieTree_insert(t *testing.T) {
 						path:     "/a/prefix1:usr/name",
 						handlers: []MiddleWare{fakeHandler},
 					},
+					{
+						path:     "/static/favicon.ico",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						path:     "/static/*filepath",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						path:     "/users/:id<int>",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						path:     "/users/:name",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						path:     "/users/:name<[a-z]+>/profile",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						path:     "/users/:id<int>/profile",
+						handlers: []MiddleWare{fakeHandler},
+					},
 				},
 			},
 		}
@@ -192,6 +318,19 @@ func Test_node_parseDynKeyFromRoute(t *testing.T) {
 					{0, 4},
 				},
 			},
+			{
+				route: "/a/:key1<(?:a|b)*>/c",
+				wantDynKeys: [][2]int{
+					{3, 17},
+				},
+			},
+			{
+				route: "/a/:key1/*filepath",
+				wantDynKeys: [][2]int{
+					{3, 7},
+					{9, 17},
+				},
+			},
 		}
 
 		for _, testCase := range testCases {
@@ -261,6 +400,20 @@ func Test_node_getLenOfPrefix(t *testing.T) {
 				},
 				shouldPanic: true,
 			},
+			{
+				route: "a/*b",
+				node: &node{
+					content: "a/*b",
+				},
+				length: 4,
+			},
+			{
+				route: "a/*c",
+				node: &node{
+					content: "a/:b",
+				},
+				shouldPanic: true,
+			},
 		}
 
 		for _, testCase := range testCases {
@@ -351,6 +504,12 @@ func Test_node_split(t *testing.T) {
 	})
 }
 
+// pathInfo 期望匹配到的路由信息
+type pathInfo struct {
+	handlers []MiddleWare
+	params   map[string]string
+}
+
 func Test_trieTree_getPathInfo(t *testing.T) {
 	convey.Convey("", t, func(){
 		fakeHandler := func(ctx *Context){}
@@ -384,6 +543,30 @@ func Test_trieTree_getPathInfo(t *testing.T) {
 						route: "/a/:key1",
 						handlers: []MiddleWare{fakeHandler},
 					},
+					{
+						route: "/static/favicon.ico",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						route: "/static/*filepath",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						route: "/proxy/:service/*rest",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						route: "/users/:name",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						route: "/users/:id<int>",
+						handlers: []MiddleWare{fakeHandler},
+					},
+					{
+						route: "/users/:id<int>/files/:file<[a-z0-9-]+>",
+						handlers: []MiddleWare{fakeHandler},
+					},
 				},
 				wantResult: map[string]*pathInfo{
 					"/a/b/c": {handlers: []MiddleWare{fakeHandler}},
@@ -393,6 +576,18 @@ func Test_trieTree_getPathInfo(t *testing.T) {
 					"/a/val1": {handlers: []MiddleWare{fakeHandler}, params: map[string]string{"key1": "val1"}},
 					"/a/preifx": {handlers: []MiddleWare{fakeHandler}, params: map[string]string{"key1": "preifx"}},
 
+					"/static/favicon.ico": {handlers: []MiddleWare{fakeHandler}},
+					"/static/": {handlers: []MiddleWare{fakeHandler}, params: map[string]string{"filepath": ""}},
+					"/static/css/main.css": {handlers: []MiddleWare{fakeHandler}, params: map[string]string{"filepath": "css/main.css"}},
+					"/proxy/user/v1/users/": {handlers: []MiddleWare{fakeHandler}, params: map[string]string{"service": "user", "rest": "v1/users/"}},
+
+					"/users/42": {handlers: []MiddleWare{fakeHandler}, params: map[string]string{"id": "42"}},
+					"/users/tom": {handlers: []MiddleWare{fakeHandler}, params: map[string]string{"name": "tom"}},
+					"/users/42/files/a-1": {handlers: []MiddleWare{fakeHandler}, params: map[string]string{"id": "42", "file": "a-1"}},
+					"/users/42/files/A_1": nil,
+					"/users/tom/files/a-1": nil,
+
+					"/static": nil,
 					"/not/exist": nil,
 				},
 			},
@@ -406,15 +601,85 @@ func Test_trieTree_getPathInfo(t *testing.T) {
 				}
 				printTrieTree(tree)
 				for route, info := range testCase.wantResult {
-					gotPathInfo := tree.getRouteInfo(route)
+					var params Params
+					gotHandlers := tree.getRouteInfo(route, &params)
 					if info == nil {
-						convey.So(gotPathInfo, convey.ShouldBeNil)
+						convey.So(gotHandlers, convey.ShouldBeNil)
+						convey.So(params, convey.ShouldBeEmpty)
 					} else {
-						convey.So(len(gotPathInfo.handlers), convey.ShouldEqual, len(info.handlers))
-						convey.So(gotPathInfo.params, convey.ShouldResemble, info.params)
+						convey.So(len(gotHandlers), convey.ShouldEqual, len(info.handlers))
+						var gotParams map[string]string
+						for _, param := range params {
+							if gotParams == nil {
+								gotParams = make(map[string]string)
+							}
+							gotParams[param.Key] = param.Value
+						}
+						convey.So(gotParams, convey.ShouldResemble, info.params)
 					}
 				}
 			})
 		}
 	})
 }
+
+func newBenchmarkTree() *trieTree {
+	fakeHandler := func(ctx *Context) {}
+	tree := newTrieTree()
+	for _, route := range []string{
+		"/users",
+		"/users/:id",
+		"/users/:id/files/:file",
+		"/users/:id<int>/orders",
+		"/static/*filepath",
+		"/api/v1/health",
+	} {
+		tree.insert(route, fakeHandler)
+	}
+	return tree
+}
+
+func Test_trieTree_getRouteInfoAllocs(t *testing.T) {
+	convey.Convey("", t, func() {
+		tree := newBenchmarkTree()
+		params := make(Params, 0, 2)
+		for _, route := range []string{"/api/v1/health", "/users/42/files/a.txt", "/users/42/orders", "/static/css/main.css"} {
+			convey.Convey(route, func() {
+				allocs := testing.AllocsPerRun(100, func() {
+					params = params[:0]
+					if tree.getRouteInfo(route, &params) == nil {
+						panic("route not found")
+					}
+				})
+				convey.So(allocs, convey.ShouldEqual, 0)
+			})
+		}
+	})
+}
+
+func benchmarkGetRouteInfo(b *testing.B, route string) {
+	tree := newBenchmarkTree()
+	params := make(Params, 0, 2)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		params = params[:0]
+		tree.getRouteInfo(route, &params)
+	}
+}
+
+func Benchmark_trieTree_getRouteInfo_static(b *testing.B) {
+	benchmarkGetRouteInfo(b, "/api/v1/health")
+}
+
+func Benchmark_trieTree_getRouteInfo_param(b *testing.B) {
+	benchmarkGetRouteInfo(b, "/users/42/files/a.txt")
+}
+
+func Benchmark_trieTree_getRouteInfo_constraint(b *testing.B) {
+	benchmarkGetRouteInfo(b, "/users/42/orders")
+}
+
+func Benchmark_trieTree_getRouteInfo_catchAll(b *testing.B) {
+	benchmarkGetRouteInfo(b, "/static/css/main.css")
+}
@@ -2,24 +2,10 @@ package util
 
 import (
 	"reflect"
+	"runtime"
 	"unsafe"
 )
 
-func MergeParam(origin *map[string]string, delta map[string]string) {
-	if len(delta) == 0 {
-		return
-	}
-
-	if *origin == nil {
-		*origin = delta
-		return
-	}
-
-	for key, value := range delta {
-		(*origin)[key] = value
-	}
-}
-
 func Byte2String(b []byte) string {
 	return *(*string)(unsafe.Pointer(&b))
 }
@@ -33,3 +19,8 @@ func String2Byte(str string) []byte {
 	}
 	return *(*[]byte)(unsafe.Pointer(&sliceHeader))
 }
+
+// NameOfFunction 获取函数名，eg: github.com/WANGgbin/mini_gin.LoggerMW
+func NameOfFunction(f interface{}) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}